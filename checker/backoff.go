@@ -0,0 +1,156 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exponential backoff shared by every worker for the whole run
+type backoff struct {
+	mu    sync.Mutex
+	base  time.Duration
+	max   time.Duration
+	level int
+}
+
+func newBackoff(base time.Duration, max time.Duration) *backoff {
+	return &backoff{base: base, max: max}
+}
+
+// Get the next wait, doubling each time and never shorter than retryAfter
+func (b *backoff) next(retryAfter time.Duration) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wait := b.base << uint(b.level)
+	if wait > b.max || wait <= 0 {
+		wait = b.max
+	} else {
+		b.level++
+	}
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+	return wait
+}
+
+// Go back to the base wait after a successful request
+func (b *backoff) reset() {
+	b.mu.Lock()
+	b.level = 0
+	b.mu.Unlock()
+}
+
+// Pause shared by every worker, so one ratelimit stops them all instead of each running into it too
+type pauseGate struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+// Start a pause as long as next returns, unless one is already going on because another worker was
+// ratelimited first, then what's left of it is returned and next isn't called
+func (p *pauseGate) start(next func() time.Duration) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if left := time.Until(p.until); left > 0 {
+		return left
+	}
+	wait := next()
+	p.until = time.Now().Add(wait)
+	return wait
+}
+
+// Wait for the pause to end, false if the context was cancelled first
+func (p *pauseGate) wait(ctx context.Context) bool {
+	p.mu.Lock()
+	left := time.Until(p.until)
+	p.mu.Unlock()
+	if left <= 0 {
+		return true
+	}
+	return sleep(ctx, left)
+}
+
+// Parse the Retry-After header, which is either seconds or a date
+func parseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// Requests the ratelimit rate is measured over for AutoThrottle
+const throttleWindow = 50
+
+// Extra delay before every request that grows while requests keep getting ratelimited and shrinks again once they don't
+type throttle struct {
+	mu     sync.Mutex
+	window [throttleWindow]bool // ratelimited or not, for the last requests
+	pos    int
+	n      int // requests in window
+	hits   int // ratelimited requests in window
+	delay  time.Duration
+	min    time.Duration // first delay once throttling starts
+	max    time.Duration
+}
+
+func newThrottle(min time.Duration, max time.Duration) *throttle {
+	return &throttle{min: min, max: max}
+}
+
+// Current delay
+func (t *throttle) wait() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.delay
+}
+
+// Record whether a request was ratelimited, doubling the delay once more than 10% of the window was
+// and halving it after a whole window without any. Returns the new delay and true when it changed.
+func (t *throttle) record(ratelimited bool) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.n == throttleWindow && t.window[t.pos] {
+		t.hits--
+	}
+	t.window[t.pos] = ratelimited
+	t.pos = (t.pos + 1) % throttleWindow
+	if t.n < throttleWindow {
+		t.n++
+	}
+	if ratelimited {
+		t.hits++
+	}
+
+	old := t.delay
+	switch {
+	case t.hits*10 > throttleWindow:
+		if t.delay == 0 {
+			t.delay = t.min
+		} else if t.delay *= 2; t.delay > t.max {
+			t.delay = t.max
+		}
+	case t.n == throttleWindow && t.hits == 0 && t.delay > 0:
+		if t.delay /= 2; t.delay < t.min {
+			t.delay = 0
+		}
+	}
+	if t.delay == old {
+		return t.delay, false
+	}
+	// Starting a new window so the requests before the change don't count towards the next one
+	t.window, t.pos, t.n, t.hits = [throttleWindow]bool{}, 0, 0, 0
+	return t.delay, true
+}
@@ -0,0 +1,102 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Second, 4*time.Second)
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		if got := b.next(0); got != want {
+			t.Errorf("next = %s, want %s", got, want)
+		}
+	}
+	if got := b.next(time.Minute); got != time.Minute {
+		t.Errorf("next with retry after = %s, want 1m0s", got)
+	}
+	b.reset()
+	if got := b.next(0); got != time.Second {
+		t.Errorf("next after reset = %s, want 1s", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+	if got := parseRetryAfter(header); got != 30*time.Second {
+		t.Errorf("parseRetryAfter = %s, want 30s", got)
+	}
+	header.Set("Retry-After", "soon")
+	if got := parseRetryAfter(header); got != 0 {
+		t.Errorf("parseRetryAfter of garbage = %s, want 0", got)
+	}
+}
+
+func TestPauseGate(t *testing.T) {
+	p := &pauseGate{}
+	calls := 0
+	next := func() time.Duration {
+		calls++
+		return 50 * time.Millisecond
+	}
+	if wait := p.start(next); wait != 50*time.Millisecond {
+		t.Errorf("first wait = %v", wait)
+	}
+	// A second ratelimit during the pause joins it instead of backing off further
+	if wait := p.start(next); wait > 50*time.Millisecond || calls != 1 {
+		t.Errorf("second wait = %v after %d calls", wait, calls)
+	}
+
+	start := time.Now()
+	if !p.wait(context.Background()) || time.Since(start) < 30*time.Millisecond {
+		t.Errorf("waited %v", time.Since(start))
+	}
+	if p.start(next); calls != 2 {
+		t.Errorf("a pause after the last one ended wasn't started, %d calls", calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if p.wait(ctx) {
+		t.Error("wait didn't stop for a cancelled context")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	th := newThrottle(time.Second, 3*time.Second)
+	record := func(n int, ratelimited bool) (time.Duration, bool) {
+		var wait time.Duration
+		changed := false
+		for i := 0; i < n; i++ {
+			if w, ok := th.record(ratelimited); ok {
+				wait, changed = w, true
+			}
+		}
+		return wait, changed
+	}
+	if _, changed := record(throttleWindow, false); changed {
+		t.Error("clean requests changed the delay")
+	}
+	if wait, _ := record(6, true); wait != time.Second {
+		t.Errorf("delay after 6 ratelimits = %v, want 1s", wait)
+	}
+	record(6, true)
+	if wait, _ := record(6, true); wait != 3*time.Second {
+		t.Errorf("delay = %v, want the 3s max", wait)
+	}
+	// Staying at the max isn't a change
+	if _, changed := record(6, true); changed {
+		t.Error("ratelimits at the max delay changed it")
+	}
+	record(throttleWindow, false)
+	if th.wait() != 1500*time.Millisecond {
+		t.Errorf("delay after a clean window = %v", th.wait())
+	}
+	record(throttleWindow, false)
+	if th.wait() != 0 {
+		t.Errorf("delay below the min = %v, want 0", th.wait())
+	}
+}
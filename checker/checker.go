@@ -0,0 +1,509 @@
+// Package checker checks Xbox codes against Microsoft's tokenDescriptions endpoint.
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Returned by Check once every WLID has been removed as unauthorized
+var ErrNoWLIDs = errors.New("every WLID is invalid, get a new one from redeem.microsoft.com")
+
+// Settings for a Checker, anything left empty gets a default
+type Config struct {
+	WLIDs      []string   // authorization values, see ParseWLID
+	Proxies    []*url.URL // one is picked for every request, none connects directly
+	UserAgents []string   // one is picked for every request, DefaultUserAgents when empty
+	Markets    []string   // tried in order until a code is found, US when empty
+	Language   string     // en-US when empty
+	Timeout    time.Duration
+	Retries    int           // times a code is retried with another WLID and proxy after a network error
+	MaxRetries int           // times a code is retried after a ratelimit, 0 for no limit
+	DelayMin   time.Duration // random wait before each request
+	DelayMax   time.Duration
+	RPS        float64           // most requests per second across every Check, 0 for no limit
+	APIBase    string            // DefaultAPIBase when empty
+	Headers    map[string]string // extra request headers, an empty value drops a built in one
+	MimicTLS   bool              // send a Chrome TLS ClientHello instead of Go's
+
+	// Most requests sent through each proxy at once, 0 for no limit
+	PerProxyConcurrency int
+	OnEvent             func(Event) // called from the checking goroutine, can be nil
+
+	// Network errors in a row before a proxy is taken out of rotation, 0 only removes the ones ValidateProxies finds dead.
+	// Once every proxy is gone Check fails with ErrNoProxies, or connects directly with DirectFallback.
+	MaxProxyFailures int
+	DirectFallback   bool
+
+	// Status codes handled like a 429 with a backoff and retry, DefaultRatelimitStatuses when nil
+	RatelimitStatuses []int
+
+	// Only cool down the ratelimited WLID instead of pausing every Check when a request is ratelimited
+	NoPause bool
+
+	// Custom rules for sorting responses, the built in ones are used when nil or it doesn't handle one
+	Classifier Classifier
+
+	// Check every code again instead of returning the result of an earlier Check of the same code
+	NoCache bool
+	// Endpoint and rules codes are checked with, TokenDescriptions when its Request is nil
+	Mode Mode
+	// Wait longer between requests while more than 10% of the recent ones are ratelimited, and less again once none are
+	AutoThrottle bool
+}
+
+// Something that happened while checking a code, before its result is known
+type Event struct {
+	Type   string // ratelimited, blocked, wlidremoved, proxyremoved, throttle or request
+	Code   string
+	Market string
+	Wait   time.Duration // backoff for ratelimited and blocked, the new delay for throttle
+	Left   int           // WLIDs left for wlidremoved, proxies left for proxyremoved
+	Proxy  string        // host of the proxy for proxyremoved
+
+	// Details of a request for request events
+	URL        string
+	WLID       string
+	Status     string
+	HTTPStatus int
+	Body       string // raw response
+	Err        error
+}
+
+// Result of checking a single code
+type Result struct {
+	Code       string
+	Market     string // market the code was checked in last
+	Status     string // valid, used, pending, expired, invalid, unknown, error, unauthorized or cancelled
+	TokenState string
+	HTTPStatus int
+	Body       string // raw response, only kept for unknown codes
+
+	// What the code redeems for, when the response says
+	Description  string
+	Subscription bool // Game Pass and other subscriptions or trials rather than one time codes
+
+	// How the product is offered in the market, from the availabilities in the response
+	Price          string // like 59.99 USD
+	Availabilities []TokenAvailability
+
+	Err error // why the code couldn't be checked, the same error Check returns
+}
+
+// Checks codes, safe to use from several goroutines at once
+type Checker struct {
+	wlids      *wlidPool
+	clients    []*http.Client
+	slots      []chan struct{} // requests in flight through each client, nil when they aren't limited
+	backoff    *backoff
+	maxRetries int
+	retries    int
+	markets    []string
+	language   string
+	delayMin   time.Duration
+	delayMax   time.Duration
+	userAgents []string
+	limiter    *rate.Limiter // nil when requests aren't limited
+	apiBase    string
+	headers    map[string]string
+	onEvent    func(Event)
+	classify   Classifier
+	request    RequestBuilder
+	pause      *pauseGate // nil with NoPause
+	throttle   *throttle  // nil without AutoThrottle
+
+	resultsMu sync.Mutex
+	results   chan Result // nil until Results is called
+	closed    bool
+	proxies   []*url.URL
+	health    *proxyHealth // nil without proxies
+
+	cacheMu sync.Mutex
+	cache   map[string]Result // results of codes that were checked, nil with NoCache
+}
+
+// Create a Checker for cfg
+func New(cfg Config) *Checker {
+	c := &Checker{
+		wlids:      newWLIDPool(cfg.WLIDs),
+		clients:    newClients(cfg.Timeout, cfg.Proxies, cfg.MimicTLS),
+		backoff:    newBackoff(5*time.Second, 5*time.Minute),
+		maxRetries: cfg.MaxRetries,
+		retries:    cfg.Retries,
+		markets:    cfg.Markets,
+		language:   cfg.Language,
+		delayMin:   cfg.DelayMin,
+		delayMax:   cfg.DelayMax,
+		userAgents: cfg.UserAgents,
+		apiBase:    cfg.APIBase,
+		headers:    cfg.Headers,
+		onEvent:    cfg.OnEvent,
+	}
+	if len(c.markets) == 0 {
+		c.markets = []string{"US"}
+	}
+	if c.language == "" {
+		c.language = "en-US"
+	}
+	if len(c.userAgents) == 0 {
+		c.userAgents = DefaultUserAgents
+	}
+	mode := cfg.Mode
+	if mode.Request == nil {
+		mode.Request = TokenDescriptions.Request
+	}
+	c.request = mode.Request
+	if c.apiBase == "" {
+		c.apiBase = mode.APIBase
+	}
+	if c.apiBase == "" {
+		c.apiBase = DefaultAPIBase
+	}
+	statuses := cfg.RatelimitStatuses
+	if statuses == nil {
+		statuses = DefaultRatelimitStatuses
+	}
+	c.classify = ratelimitClassifier(statuses, chainClassifiers(cfg.Classifier, mode.Classifier))
+	if !cfg.NoPause {
+		c.pause = &pauseGate{}
+	}
+	if !cfg.NoCache {
+		c.cache = make(map[string]Result)
+	}
+	if cfg.AutoThrottle {
+		c.throttle = newThrottle(500*time.Millisecond, 30*time.Second)
+	}
+	if cfg.RPS > 0 {
+		c.limiter = rate.NewLimiter(rate.Limit(cfg.RPS), 1)
+	}
+	if len(cfg.Proxies) > 0 {
+		c.proxies = cfg.Proxies
+		direct := -1
+		if cfg.DirectFallback {
+			c.clients = append(c.clients, newClient(cfg.Timeout, nil, cfg.MimicTLS))
+			direct = len(c.clients) - 1
+		}
+		c.health = newProxyHealth(len(cfg.Proxies), cfg.MaxProxyFailures, direct)
+	}
+	if cfg.PerProxyConcurrency > 0 && len(cfg.Proxies) > 0 {
+		c.slots = make([]chan struct{}, len(c.clients))
+		for i := range c.slots {
+			c.slots[i] = make(chan struct{}, cfg.PerProxyConcurrency)
+		}
+	}
+	return c
+}
+
+// Send an event if anyone is listening
+func (c *Checker) emit(ev Event) {
+	if c.onEvent != nil {
+		c.onEvent(ev)
+	}
+}
+
+// Sleep a random time within the delay range before a request, plus the auto throttle delay
+func (c *Checker) delay(ctx context.Context) {
+	var wait time.Duration
+	if c.throttle != nil {
+		wait = c.throttle.wait()
+	}
+	if c.delayMax > 0 {
+		wait += c.delayMin
+		if c.delayMax > c.delayMin {
+			wait += time.Duration(rand.Int63n(int64(c.delayMax - c.delayMin + 1)))
+		}
+	}
+	if wait > 0 {
+		sleep(ctx, wait)
+	}
+}
+
+// Take a request slot on a client, falling back to any other client with a free slot before waiting for this one.
+// Returns the client that was taken, false if the context was cancelled while waiting.
+func (c *Checker) acquire(ctx context.Context, client int) (int, bool) {
+	if c.slots == nil {
+		return client, true
+	}
+	for i := range c.slots {
+		other := (client + i) % len(c.slots)
+		if c.health != nil && !c.health.usable(other) {
+			continue
+		}
+		select {
+		case c.slots[other] <- struct{}{}:
+			return other, true
+		default:
+		}
+	}
+	select {
+	case c.slots[client] <- struct{}{}:
+		return client, true
+	case <-ctx.Done():
+		return client, false
+	}
+}
+
+// Give back a slot taken with acquire
+func (c *Checker) release(client int) {
+	if c.slots != nil {
+		<-c.slots[client]
+	}
+}
+
+// Pick the client for a request, other than last when there are others, false once every proxy was removed
+func (c *Checker) pickClient(last int) (int, bool) {
+	if c.health != nil {
+		return c.health.pick(last)
+	}
+	return pickOther(len(c.clients), last), true
+}
+
+// Pick a random index below n that isn't last, unless it's the only one
+func pickOther(n int, last int) int {
+	if n <= 1 || last < 0 || last >= n {
+		return rand.Intn(n)
+	}
+	i := rand.Intn(n - 1)
+	if i >= last {
+		i++
+	}
+	return i
+}
+
+// Sleep unless the context is cancelled first, false if it was cancelled
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Check a code in each market until it is found, retrying after network errors and ratelimits.
+// The error is set when the code couldn't be checked, with the status error, unauthorized or cancelled.
+// A code that was already checked gets the same result without another request, codes that errored are checked again.
+func (c *Checker) Check(ctx context.Context, code string) (Result, error) {
+	// Malformed codes are invalid straight away, without waiting for a delay, an rps token or a WLID
+	if !IsValidCodeFormat(code) {
+		res := Result{Code: code, Status: "invalid"}
+		c.publish(ctx, res)
+		return res, nil
+	}
+	if res, ok := c.cached(code); ok {
+		c.publish(ctx, res)
+		return res, nil
+	}
+	var res Result
+	var err error
+	for _, market := range c.markets {
+		res, err = c.checkMarket(ctx, code, market)
+
+		// Only codes that aren't found are tried in the next market
+		if res.Status != "invalid" {
+			break
+		}
+	}
+	res.Err = err
+	if err == nil {
+		c.store(res)
+	}
+	c.publish(ctx, res)
+	return res, err
+}
+
+// Result of an earlier Check of code
+func (c *Checker) cached(code string) (Result, bool) {
+	if c.cache == nil {
+		return Result{}, false
+	}
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	res, ok := c.cache[code]
+	return res, ok
+}
+
+// Keep a result so checking its code again doesn't send another request
+func (c *Checker) store(res Result) {
+	if c.cache == nil {
+		return
+	}
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	c.cache[res.Code] = res
+}
+
+// Channel every finished Check sends its result on, for GUIs and other frontends that want results as they happen.
+// Once it has been asked for it has to be read or Check waits for it, Close closes it after the last Check.
+func (c *Checker) Results() <-chan Result {
+	c.resultsMu.Lock()
+	defer c.resultsMu.Unlock()
+	if c.results == nil {
+		c.results = make(chan Result, 64)
+		if c.closed {
+			close(c.results)
+		}
+	}
+	return c.results
+}
+
+// Close the Results channel, no Check can be running or started afterwards
+func (c *Checker) Close() {
+	c.resultsMu.Lock()
+	defer c.resultsMu.Unlock()
+	if c.results != nil && !c.closed {
+		close(c.results)
+	}
+	c.closed = true
+}
+
+// Send a result to the Results channel if anyone asked for it, unless ctx is cancelled first
+func (c *Checker) publish(ctx context.Context, res Result) {
+	c.resultsMu.Lock()
+	results := c.results
+	closed := c.closed
+	c.resultsMu.Unlock()
+	if results == nil || closed {
+		return
+	}
+	select {
+	case results <- res:
+	case <-ctx.Done():
+	}
+}
+
+// Check a code in one market
+func (c *Checker) checkMarket(ctx context.Context, code string, market string) (Result, error) {
+	attempts := 0
+	ratelimits := 0
+	lastWLID, lastClient := "", -1
+	for {
+		if ctx.Err() != nil {
+			return Result{Code: code, Market: market, Status: "cancelled"}, ctx.Err()
+		}
+
+		// Using a different WLID and proxy than a failed attempt when there are others
+		wlid, wait, ok := c.wlids.pickExcept(lastWLID)
+		if !ok {
+			return Result{Code: code, Market: market, Status: "unauthorized"}, ErrNoWLIDs
+		}
+		if wait > 0 {
+			// Every WLID is ratelimited, waiting for the first to cool down
+			sleep(ctx, wait)
+			continue
+		}
+		if c.pause != nil && !c.pause.wait(ctx) {
+			return Result{Code: code, Market: market, Status: "cancelled"}, ctx.Err()
+		}
+		client, ok := c.pickClient(lastClient)
+		if !ok {
+			return Result{Code: code, Market: market, Status: "error"}, ErrNoProxies
+		}
+		lastWLID, lastClient = "", -1
+		c.delay(ctx)
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return Result{Code: code, Market: market, Status: "cancelled"}, ctx.Err()
+			}
+		}
+		client, ok = c.acquire(ctx, client)
+		if !ok {
+			return Result{Code: code, Market: market, Status: "cancelled"}, ctx.Err()
+		}
+		r := CodeRequest{Base: c.apiBase, Code: code, Market: market, Language: c.language, WLID: wlid, UserAgent: c.userAgents[rand.Intn(len(c.userAgents))], Headers: c.headers}
+		status, info, err := checkCode(ctx, r, c.clients[client], c.request, c.classify)
+		c.release(client)
+		if info.url != "" {
+			c.emit(Event{Type: "request", Code: code, Market: market, URL: info.url, WLID: wlid, Status: status, HTTPStatus: info.httpStatus, Body: info.raw, Err: err})
+		}
+		if ctx.Err() != nil {
+			return Result{Code: code, Market: market, Status: "cancelled"}, ctx.Err()
+		}
+		if c.throttle != nil && info.url != "" {
+			if wait, changed := c.throttle.record(status == "ratelimited"); changed {
+				c.emit(Event{Type: "throttle", Code: code, Market: market, Wait: wait})
+			}
+		}
+		if c.health != nil {
+			if removed, left := c.health.record(client, status == "retry"); removed {
+				c.emit(Event{Type: "proxyremoved", Code: code, Market: market, Left: left, Proxy: c.proxies[client].Host})
+			}
+		}
+		res := Result{Code: code, Market: market, Status: status, TokenState: info.tokenState, HTTPStatus: info.httpStatus, Body: info.body, Description: info.description, Subscription: info.subscription, Price: info.price, Availabilities: info.availabilities}
+
+		// Dropping the WLID and retrying the same code with another one
+		if status == "unauthorized" {
+			left := c.wlids.remove(wlid)
+			if left == 0 {
+				return res, ErrNoWLIDs
+			}
+			c.emit(Event{Type: "wlidremoved", Code: code, Market: market, Left: left})
+			continue
+		}
+
+		// Retrying the same code after a network error
+		if status == "retry" {
+			attempts++
+			if attempts <= c.retries {
+				lastWLID, lastClient = wlid, client
+				sleep(ctx, time.Second)
+				continue
+			}
+			res.Status = "error"
+			return res, err
+		}
+
+		// Backing off and retrying the same code through another proxy
+		if status == "blocked" {
+			ratelimits++
+			if c.maxRetries > 0 && ratelimits > c.maxRetries {
+				res.Status = "error"
+				return res, fmt.Errorf("still blocked after %d retries", c.maxRetries)
+			}
+			wait := c.backoff.next(0)
+			c.emit(Event{Type: status, Code: code, Market: market, Wait: wait})
+			lastClient = client
+			sleep(ctx, wait)
+			continue
+		}
+
+		// Cooling the WLID down and retrying the same code with the others
+		if status == "ratelimited" {
+			ratelimits++
+			if c.maxRetries > 0 && ratelimits > c.maxRetries {
+				res.Status = "error"
+				return res, fmt.Errorf("still ratelimited after %d retries", c.maxRetries)
+			}
+			var retryAfter time.Duration
+			if rle, ok := err.(*rateLimitError); ok {
+				retryAfter = rle.retryAfter
+			}
+			var wait time.Duration
+			if c.pause != nil {
+				// Requests already sent when the pause started don't make it longer
+				wait = c.pause.start(func() time.Duration { return c.backoff.next(retryAfter) })
+			} else {
+				wait = c.backoff.next(retryAfter)
+			}
+			c.wlids.cooldown(wlid, wait)
+			c.emit(Event{Type: status, Code: code, Market: market, Wait: wait})
+			continue
+		}
+
+		c.backoff.reset()
+		if err != nil {
+			res.Status = "error"
+		}
+		return res, err
+	}
+}
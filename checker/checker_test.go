@@ -0,0 +1,364 @@
+package checker
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckMarkets(t *testing.T) {
+	// Only found in GB
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("market") == "GB" {
+			w.Write([]byte(`{"tokenState":"Active"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"NotFound"}`))
+	}))
+	defer server.Close()
+
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, Markets: []string{"US", "GB", "DE"}, APIBase: server.URL + "/"})
+	res, err := c.Check(context.Background(), mockCode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Status != "valid" || res.Market != "GB" || res.TokenState != "Active" || res.HTTPStatus != 200 {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestCheckRetriesCutOffBody(t *testing.T) {
+	// The first response is cut off partway through its body
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n{\"tokenState\":"))
+			conn.Close()
+			return
+		}
+		w.Write([]byte(`{"tokenState":"Active"}`))
+	}))
+	defer server.Close()
+
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, APIBase: server.URL + "/", Retries: 1})
+	res, err := c.Check(context.Background(), mockCode)
+	if err != nil || res.Status != "valid" || atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("result = %+v, err = %v after %d requests", res, err, requests)
+	}
+}
+
+func TestCheckRemovesUnauthorizedWLIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") != `WLID1.0="good"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"Unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"tokenState":"Redeemed"}`))
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var events []Event
+	c := New(Config{
+		WLIDs:   []string{`WLID1.0="bad"`, `WLID1.0="good"`},
+		APIBase: server.URL + "/",
+		NoCache: true,
+		OnEvent: func(ev Event) {
+			mu.Lock()
+			events = append(events, ev)
+			mu.Unlock()
+		},
+	})
+	for i := 0; i < 5; i++ {
+		res, err := c.Check(context.Background(), mockCode)
+		if err != nil || res.Status != "used" {
+			t.Fatalf("result = %+v, %v, want used", res, err)
+		}
+	}
+	if c.WLIDsLeft() != 1 {
+		t.Errorf("WLIDs left = %d, want 1", c.WLIDsLeft())
+	}
+	removed := 0
+	for _, ev := range events {
+		if ev.Type == "wlidremoved" {
+			removed++
+		}
+	}
+	if removed > 1 {
+		t.Errorf("removed %d WLIDs, want at most 1", removed)
+	}
+
+	// Once the last WLID is gone every check fails
+	c = New(Config{WLIDs: []string{`WLID1.0="bad"`}, APIBase: server.URL + "/"})
+	if _, err := c.Check(context.Background(), mockCode); err != ErrNoWLIDs {
+		t.Errorf("err = %v, want ErrNoWLIDs", err)
+	}
+}
+
+func TestValidateWLIDs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") == `WLID1.0="bad"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"Unauthorized"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"NotFound"}`))
+	}))
+	defer server.Close()
+
+	c := New(Config{WLIDs: []string{`WLID1.0="good"`, `WLID1.0="bad"`, `WLID1.0="also good"`}, APIBase: server.URL + "/"})
+	dead := c.ValidateWLIDs(context.Background())
+	if len(dead) != 1 || dead[0] != 1 {
+		t.Errorf("dead = %v, want [1]", dead)
+	}
+	if c.WLIDsLeft() != 2 {
+		t.Errorf("WLIDs left = %d, want 2", c.WLIDsLeft())
+	}
+}
+
+func TestCheckCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}})
+	res, err := c.Check(ctx, mockCode)
+	if res.Status != "cancelled" || err != context.Canceled {
+		t.Errorf("result = %+v, %v, want cancelled", res, err)
+	}
+}
+
+func TestCheckPerProxyConcurrency(t *testing.T) {
+	// Stands in for the proxy and the endpoint, plain HTTP requests are sent to the proxy as is
+	var inFlight, most atomic.Int64
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte(`{"tokenState":"Active"}`))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, Proxies: []*url.URL{proxyURL}, APIBase: "http://example.invalid/", PerProxyConcurrency: 2, NoCache: true})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.Check(context.Background(), mockCode); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if most.Load() != 2 {
+		t.Errorf("most requests at once = %d, want 2", most.Load())
+	}
+}
+
+func TestCheckRemovesDeadProxies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tokenState":"Active"}`))
+	}))
+	defer server.Close()
+	// Nothing listens on a closed server, so every request through it fails
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	deadURL, _ := url.Parse(dead.URL)
+
+	var removed []Event
+	cfg := Config{WLIDs: []string{`WLID1.0="test"`}, Proxies: []*url.URL{deadURL}, APIBase: server.URL + "/", MaxProxyFailures: 2, OnEvent: func(ev Event) {
+		if ev.Type == "proxyremoved" {
+			removed = append(removed, ev)
+		}
+	}}
+	c := New(cfg)
+	for i := 0; i < 2; i++ {
+		if res, _ := c.Check(context.Background(), mockCode); res.Status != "error" {
+			t.Errorf("status through a dead proxy = %q", res.Status)
+		}
+	}
+	if len(removed) != 1 || removed[0].Left != 0 || removed[0].Proxy != deadURL.Host {
+		t.Errorf("proxyremoved events = %+v", removed)
+	}
+	if _, err := c.Check(context.Background(), mockCode); err != ErrNoProxies {
+		t.Errorf("err = %v, want ErrNoProxies", err)
+	}
+
+	cfg.DirectFallback = true
+	c = New(cfg)
+	c.Check(context.Background(), mockCode)
+	c.Check(context.Background(), mockCode)
+	if res, err := c.Check(context.Background(), mockCode); res.Status != "valid" || err != nil {
+		t.Errorf("status = %q, err = %v, want a direct check", res.Status, err)
+	}
+}
+
+func TestValidateProxies(t *testing.T) {
+	// Stands in for a working proxy too, plain HTTP requests are sent to the proxy as is
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	deadURL, _ := url.Parse(dead.URL)
+
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, Proxies: []*url.URL{serverURL, deadURL}, APIBase: server.URL + "/", MaxProxyFailures: 5})
+	if dead := c.ValidateProxies(context.Background()); len(dead) != 1 || dead[0] != 1 {
+		t.Errorf("dead = %v, want [1]", dead)
+	}
+	if left := c.ProxiesLeft(); left != 1 {
+		t.Errorf("proxies left = %d, want 1", left)
+	}
+}
+
+func TestValidateWLIDsThroughLiveProxy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") == `WLID1.0="bad"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"Unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"code":"NotFound"}`))
+	}))
+	defer server.Close()
+	serverURL, _ := url.Parse(server.URL)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	deadURL, _ := url.Parse(dead.URL)
+
+	// The dead proxy comes first and proxies are tested even when they are never removed while checking
+	c := New(Config{WLIDs: []string{`WLID1.0="bad"`, `WLID1.0="good"`}, Proxies: []*url.URL{deadURL, serverURL}, APIBase: server.URL + "/"})
+	if dead := c.ValidateProxies(context.Background()); len(dead) != 1 || dead[0] != 0 {
+		t.Errorf("dead proxies = %v, want [0]", dead)
+	}
+	if dead := c.ValidateWLIDs(context.Background()); len(dead) != 1 || dead[0] != 0 {
+		t.Errorf("dead WLIDs = %v, want [0]", dead)
+	}
+}
+
+func TestCheckResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") == `WLID1.0="bad"` {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"Unauthorized"}`))
+			return
+		}
+		w.Write([]byte(`{"tokenState":"Active"}`))
+	}))
+	defer server.Close()
+
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, APIBase: server.URL + "/", Markets: []string{"GB"}})
+	results := c.Results()
+	c.Check(context.Background(), mockCode)
+	c.Check(context.Background(), "not-a-code")
+	c.Close()
+	var got []Result
+	for res := range results {
+		got = append(got, res)
+	}
+	if len(got) != 2 || got[0].Code != mockCode || got[0].Status != "valid" || got[0].Market != "GB" || got[1].Status != "invalid" {
+		t.Errorf("results = %+v", got)
+	}
+
+	c = New(Config{WLIDs: []string{`WLID1.0="bad"`}, APIBase: server.URL + "/"})
+	results = c.Results()
+	go func() {
+		c.Check(context.Background(), mockCode)
+		c.Close()
+	}()
+	if res := <-results; res.Err != ErrNoWLIDs {
+		t.Errorf("err = %v, want ErrNoWLIDs", res.Err)
+	}
+}
+
+func TestCheckCache(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"tokenState":"Active"}`))
+	}))
+	defer server.Close()
+
+	cfg := Config{WLIDs: []string{`WLID1.0="test"`}, APIBase: server.URL + "/"}
+	c := New(cfg)
+	c.Check(context.Background(), mockCode)
+	if res, err := c.Check(context.Background(), mockCode); res.Status != "valid" || err != nil {
+		t.Errorf("cached status = %q, err = %v", res.Status, err)
+	}
+	if requests != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+
+	cfg.NoCache = true
+	c = New(cfg)
+	c.Check(context.Background(), mockCode)
+	c.Check(context.Background(), mockCode)
+	if requests != 3 {
+		t.Errorf("requests with NoCache = %d, want 3", requests)
+	}
+}
+
+func TestCheckMode(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/eligibility/"+mockCode {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"eligible":true}`))
+	}))
+	defer server.Close()
+
+	mode := Mode{
+		APIBase: server.URL + "/eligibility/",
+		Request: func(ctx context.Context, r CodeRequest) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, "GET", r.Base+r.Code, nil)
+		},
+		Classifier: func(status int, body []byte) (string, bool) {
+			return "valid", bytes.Contains(body, []byte(`"eligible":true`))
+		},
+	}
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, Mode: mode})
+	if res, err := c.Check(context.Background(), mockCode); res.Status != "valid" || err != nil {
+		t.Errorf("status = %q, err = %v", res.Status, err)
+	}
+}
+
+func TestCheckMalformedSkipsDelay(t *testing.T) {
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, APIBase: "http://example.invalid/", Markets: []string{"US", "GB", "DE"}, DelayMin: 300 * time.Millisecond, DelayMax: 300 * time.Millisecond})
+	start := time.Now()
+	if res, err := c.Check(context.Background(), "not-a-code"); res.Status != "invalid" || err != nil {
+		t.Errorf("status = %q, err = %v", res.Status, err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("malformed code took %v", elapsed)
+	}
+}
+
+func TestCheckMalformedSkipsLimiter(t *testing.T) {
+	c := New(Config{WLIDs: []string{`WLID1.0="test"`}, APIBase: "http://example.invalid/", Markets: []string{"US", "GB", "DE"}, RPS: 2})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		c.Check(context.Background(), "not-a-code")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("3 malformed codes took %v at 2 rps", elapsed)
+	}
+}
@@ -0,0 +1,85 @@
+package checker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Custom rule for sorting a response into a bucket, ok false leaves it to DefaultClassifier.
+// The bucket is one of valid, used, pending, expired, invalid, unknown, ratelimited, blocked, unauthorized or retry.
+type Classifier func(status int, body []byte) (bucket string, ok bool)
+
+// Buckets a Classifier can return
+var buckets = map[string]bool{
+	"valid":        true,
+	"used":         true,
+	"pending":      true,
+	"expired":      true,
+	"invalid":      true,
+	"unknown":      true,
+	"ratelimited":  true,
+	"blocked":      true,
+	"unauthorized": true,
+	"retry":        true,
+}
+
+// Built in classification of a response, ok is false when the response couldn't be understood
+func DefaultClassifier(status int, body []byte) (string, bool) {
+	bucket, _, _ := classifyResponse(status, http.Header{}, body)
+	return bucket, bucket != ""
+}
+
+// Classify a response with classify first, falling back to the built in rules when it is nil or doesn't handle it
+func classifyWith(classify Classifier, statusCode int, header http.Header, content []byte) (status string, info tokenInfo, err error) {
+	status, info, err = classifyResponse(statusCode, header, content)
+	if classify == nil {
+		return status, info, err
+	}
+	bucket, ok := classify(statusCode, content)
+	if !ok || bucket == status {
+		return status, info, err
+	}
+	if !buckets[bucket] {
+		return "", info, fmt.Errorf("classifier returned unknown bucket %q", bucket)
+	}
+
+	// Errors the checker expects with each bucket
+	switch bucket {
+	case "ratelimited":
+		return bucket, info, &rateLimitError{retryAfter: parseRetryAfter(header)}
+	case "blocked":
+		return bucket, info, errors.New("blocked by a classifier rule")
+	case "retry":
+		return bucket, info, errors.New("retry asked for by a classifier rule")
+	case "unknown":
+		info.body = string(content)
+	}
+	return bucket, info, nil
+}
+
+// Status codes Microsoft throttles with, treated like a 429 when Config.RatelimitStatuses is nil
+var DefaultRatelimitStatuses = []int{429, 403, 503}
+
+// Classifier that sorts responses with one of statuses as ratelimited, after classify had its go.
+// Only responses the built in rules can't make sense of are overridden, so challenge pages stay blocked
+// and a recognized body like an unauthorized WLID keeps its bucket.
+func ratelimitClassifier(statuses []int, classify Classifier) Classifier {
+	ratelimited := map[int]bool{}
+	for _, status := range statuses {
+		ratelimited[status] = true
+	}
+	return func(status int, body []byte) (string, bool) {
+		if classify != nil {
+			if bucket, ok := classify(status, body); ok {
+				return bucket, true
+			}
+		}
+		if ratelimited[status] {
+			if bucket, _, _ := classifyResponse(status, http.Header{}, body); bucket == "" || bucket == "unknown" {
+				return "ratelimited", true
+			}
+		}
+		return "", false
+	}
+}
@@ -0,0 +1,71 @@
+package checker
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClassifyWith(t *testing.T) {
+	quarantined := func(status int, body []byte) (string, bool) {
+		if bytes.Contains(body, []byte("Quarantined")) {
+			return "invalid", true
+		}
+		return "", false
+	}
+	tests := []struct {
+		classify Classifier
+		body     string
+		want     string
+	}{
+		{quarantined, `{"tokenState":"Quarantined"}`, "invalid"},
+		{quarantined, `{"tokenState":"Active"}`, "valid"},
+		{nil, `{"tokenState":"Quarantined"}`, "unknown"},
+		{func(int, []byte) (string, bool) { return "ratelimited", true }, `{"tokenState":"Active"}`, "ratelimited"},
+	}
+	for _, test := range tests {
+		status, _, _ := classifyWith(test.classify, 200, http.Header{}, []byte(test.body))
+		if status != test.want {
+			t.Errorf("%s: status = %q, want %q", test.body, status, test.want)
+		}
+	}
+
+	_, _, err := classifyWith(func(int, []byte) (string, bool) { return "great", true }, 200, http.Header{}, []byte(`{}`))
+	if err == nil {
+		t.Error("unknown bucket wasn't an error")
+	}
+}
+
+func TestDefaultClassifier(t *testing.T) {
+	if bucket, ok := DefaultClassifier(200, []byte(`{"tokenState":"Redeemed"}`)); bucket != "used" || !ok {
+		t.Errorf("bucket = %q, ok = %v", bucket, ok)
+	}
+	if _, ok := DefaultClassifier(200, []byte(`oops`)); ok {
+		t.Error("garbage was classified")
+	}
+}
+
+func TestRatelimitClassifier(t *testing.T) {
+	classify := ratelimitClassifier(DefaultRatelimitStatuses, nil)
+	header := http.Header{"Retry-After": {"7"}}
+	status, _, err := classifyWith(classify, 403, header, []byte(`{"code":"Forbidden"}`))
+	if rle, ok := err.(*rateLimitError); status != "ratelimited" || !ok || rle.retryAfter != 7*time.Second {
+		t.Errorf("403: status = %q, err = %v", status, err)
+	}
+	if status, _, _ := classifyWith(classify, 403, http.Header{}, []byte(`<html>captcha</html>`)); status != "blocked" {
+		t.Errorf("403 challenge page: status = %q, want blocked", status)
+	}
+	if status, _, _ := classifyWith(classify, 403, http.Header{}, []byte(`{"code":"Unauthorized"}`)); status != "unauthorized" {
+		t.Errorf("403 unauthorized WLID: status = %q, want unauthorized", status)
+	}
+	if status, _, _ := classifyWith(classify, 503, http.Header{}, nil); status != "ratelimited" {
+		t.Errorf("503 without a body: status = %q, want ratelimited", status)
+	}
+	if status, _, _ := classifyWith(classify, 200, http.Header{}, []byte(`{"tokenState":"Active"}`)); status != "valid" {
+		t.Errorf("200: status = %q", status)
+	}
+	if status, _, _ := classifyWith(ratelimitClassifier([]int{}, nil), 503, http.Header{}, []byte(`{"code":"Unavailable"}`)); status == "ratelimited" {
+		t.Error("503 ratelimited without being listed")
+	}
+}
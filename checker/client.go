@@ -0,0 +1,49 @@
+package checker
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Create the http client used for checking codes, proxy can be nil for a direct connection.
+// With mimicTLS the TLS handshake looks like Chrome's instead of Go's.
+func newClient(timeout time.Duration, proxy *url.URL, mimicTLS bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: timeout,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   10,
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if mimicTLS {
+		// The dialer goes through the proxy itself, the transport would do its own TLS otherwise
+		transport.Proxy = nil
+		transport.DialTLSContext = (&mimicDialer{dialer: dialer, proxy: proxy}).DialTLSContext
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// Create one client per proxy, or a single direct client without proxies
+func newClients(timeout time.Duration, proxies []*url.URL, mimicTLS bool) []*http.Client {
+	if len(proxies) == 0 {
+		return []*http.Client{newClient(timeout, nil, mimicTLS)}
+	}
+	clients := make([]*http.Client, len(proxies))
+	for i, proxy := range proxies {
+		clients[i] = newClient(timeout, proxy, mimicTLS)
+	}
+	return clients
+}
@@ -0,0 +1,69 @@
+package checker
+
+import (
+	"regexp"
+	"strings"
+)
+
+// 25 character codes, either as five dash separated groups or without dashes
+var codeFormat = regexp.MustCompile(`(?i)^(?:[A-Z0-9]{5}-){4}[A-Z0-9]{5}$|^[A-Z0-9]{25}$`)
+
+// Five groups of five separated by spaces, as some sources list codes
+var spacedFormat = regexp.MustCompile(`(?i)^[A-Z0-9]{5}(?:[ \t]+[A-Z0-9]{5}){4}$`)
+
+// Check if a code looks like XXXXX-XXXXX-XXXXX-XXXXX-XXXXX
+func IsValidCodeFormat(code string) bool {
+	return codeFormat.MatchString(code)
+}
+
+// Trim and uppercase a code, adding dashes to 25 character codes without them or with spaces between the groups,
+// anything after # or | is a comment
+func NormalizeCode(code string) string {
+	code, _ = normalizeCode(code)
+	return code
+}
+
+// Normalize a code, repaired is true when its groups were separated by spaces
+func normalizeCode(code string) (normalized string, repaired bool) {
+	if i := strings.IndexAny(code, "#|"); i >= 0 {
+		code = code[:i]
+	}
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if spacedFormat.MatchString(code) {
+		code, repaired = strings.Join(strings.Fields(code), "-"), true
+	}
+	if len(code) == 25 && !strings.Contains(code, "-") {
+		code = code[0:5] + "-" + code[5:10] + "-" + code[10:15] + "-" + code[15:20] + "-" + code[20:25]
+	}
+	return code, repaired
+}
+
+// Normalize every code, dropping blank lines and duplicates, repaired counts the codes that had spaces between their groups
+func NormalizeCodes(codes []string) (normalized []string, duplicates int, repaired int) {
+	seen := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		code, spaced := normalizeCode(code)
+		if code == "" {
+			continue
+		}
+		if _, ok := seen[code]; ok {
+			duplicates++
+			continue
+		}
+		if spaced {
+			repaired++
+		}
+		seen[code] = struct{}{}
+		normalized = append(normalized, code)
+	}
+	return normalized, duplicates, repaired
+}
+
+// Hide the last two groups of a code so it can be shown safely, malformed codes are returned as is
+func MaskCode(code string) string {
+	if !IsValidCodeFormat(code) {
+		return code
+	}
+	code = NormalizeCode(code)
+	return code[0:17] + "-XXXXX-XXXXX"
+}
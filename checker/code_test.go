@@ -0,0 +1,41 @@
+package checker
+
+import "testing"
+
+func TestNormalizeCode(t *testing.T) {
+	tests := map[string]string{
+		"aaaaa-bbbbb-ccccc-ddddd-eeeee":           "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE",
+		"  AAAAABBBBBCCCCCDDDDDEEEEE  ":           "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE",
+		"AAAAA-BBBBB-CCCCC-DDDDD-EEEEE # timeout": "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE",
+		"AAAAA-BBBBB-CCCCC-DDDDD-EEEEE | US":      "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE",
+		"# comment":                               "",
+		"aaaaa bbbbb  ccccc\tddddd eeeee":         "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE",
+	}
+	for in, want := range tests {
+		if got := NormalizeCode(in); got != want {
+			t.Errorf("NormalizeCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeCodes(t *testing.T) {
+	codes, duplicates, repaired := NormalizeCodes([]string{"AAAAABBBBBCCCCCDDDDDEEEEE", "", "aaaaa-bbbbb-ccccc-ddddd-eeeee", "other", "FFFFF GGGGG HHHHH IIIII JJJJJ"})
+	if len(codes) != 3 || codes[0] != "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE" || codes[1] != "OTHER" || codes[2] != "FFFFF-GGGGG-HHHHH-IIIII-JJJJJ" {
+		t.Errorf("codes = %q", codes)
+	}
+	if duplicates != 1 {
+		t.Errorf("duplicates = %d, want 1", duplicates)
+	}
+	if repaired != 1 {
+		t.Errorf("repaired = %d, want 1", repaired)
+	}
+}
+
+func TestMaskCode(t *testing.T) {
+	if got := MaskCode("AAAAA-BBBBB-CCCCC-DDDDD-EEEEE"); got != "AAAAA-BBBBB-CCCCC-XXXXX-XXXXX" {
+		t.Errorf("maskCode = %q", got)
+	}
+	if got := MaskCode("short"); got != "short" {
+		t.Errorf("maskCode of a malformed code = %q", got)
+	}
+}
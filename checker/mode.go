@@ -0,0 +1,65 @@
+package checker
+
+import (
+	"context"
+	"net/http"
+	"sort"
+)
+
+// What a request for checking a code is built from
+type CodeRequest struct {
+	Base      string // endpoint the code is checked against
+	Code      string
+	Market    string
+	Language  string
+	WLID      string // empty when only testing a proxy
+	UserAgent string
+	Headers   map[string]string // override the built in headers, an empty value drops one
+}
+
+// Builds the request for checking a code
+type RequestBuilder func(ctx context.Context, r CodeRequest) (*http.Request, error)
+
+// Endpoint codes are checked against and how, so other endpoints can plug in their own request and rules
+type Mode struct {
+	APIBase    string         // used unless Config.APIBase is set
+	Request    RequestBuilder // newCodeRequest's tokenDescriptions request when nil
+	Classifier Classifier     // sorts responses after Config.Classifier and before the built in rules, can be nil
+}
+
+// Checks codes against tokenDescriptions, used when Config.Mode is empty
+var TokenDescriptions = Mode{APIBase: DefaultAPIBase, Request: newCodeRequest}
+
+// Modes by the name -mode picks them with, more can be added before the flags are parsed
+var Modes = map[string]Mode{
+	"tokendescriptions": TokenDescriptions,
+}
+
+// Default mode name, for -mode
+const DefaultMode = "tokendescriptions"
+
+// Names of every mode, sorted
+func ModeNames() []string {
+	names := make([]string, 0, len(Modes))
+	for name := range Modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Classifier trying first and then second
+func chainClassifiers(first Classifier, second Classifier) Classifier {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func(status int, body []byte) (string, bool) {
+		if bucket, ok := first(status, body); ok {
+			return bucket, true
+		}
+		return second(status, body)
+	}
+}
@@ -0,0 +1,143 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+)
+
+// Returned by Check once every proxy has been removed after failing too many times in a row
+var ErrNoProxies = errors.New("every proxy failed too many times in a row and was removed")
+
+// Consecutive network errors of each proxy client, so dead proxies are taken out of rotation
+type proxyHealth struct {
+	mu       sync.Mutex
+	max      int // failures in a row before a proxy is removed, 0 never removes one
+	failures []int
+	dead     []bool
+	alive    int
+	direct   int // index of the direct client used once every proxy is dead, -1 for none
+}
+
+func newProxyHealth(proxies int, max int, direct int) *proxyHealth {
+	return &proxyHealth{max: max, failures: make([]int, proxies), dead: make([]bool, proxies), alive: proxies, direct: direct}
+}
+
+// Pick a random live proxy that isn't last, unless it's the only one.
+// Once every proxy is dead the direct client is picked, false when there isn't one.
+func (h *proxyHealth) pick(last int) (int, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.alive == 0 {
+		return h.direct, h.direct >= 0
+	}
+	live := make([]int, 0, h.alive)
+	for i, dead := range h.dead {
+		if !dead && (i != last || h.alive == 1) {
+			live = append(live, i)
+		}
+	}
+	return live[rand.Intn(len(live))], true
+}
+
+// Whether a client can be used, the direct one only once every proxy is dead
+func (h *proxyHealth) usable(client int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client >= len(h.dead) {
+		return h.alive == 0
+	}
+	return !h.dead[client]
+}
+
+// Take a proxy out of rotation, false if it already was
+func (h *proxyHealth) remove(client int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client >= len(h.dead) || h.dead[client] {
+		return false
+	}
+	h.dead[client] = true
+	h.alive--
+	return true
+}
+
+// Record whether a request through a client failed with a network error.
+// Returns true when the proxy was removed by this failure and how many are left.
+func (h *proxyHealth) record(client int, failed bool) (removed bool, left int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if client >= len(h.dead) || h.dead[client] || h.max <= 0 {
+		return false, h.alive
+	}
+	if !failed {
+		h.failures[client] = 0
+		return false, h.alive
+	}
+	h.failures[client]++
+	if h.failures[client] < h.max {
+		return false, h.alive
+	}
+	h.dead[client] = true
+	h.alive--
+	return true, h.alive
+}
+
+// Proxies tested at once by ValidateProxies
+const proxyTestWorkers = 20
+
+// Send a test request through each proxy and drop the ones that can't connect, dead holds their indexes in Config.Proxies.
+// The request has no WLID so it can't use one up, any response means the proxy works.
+// Nothing is removed when ctx is cancelled while testing.
+func (c *Checker) ValidateProxies(ctx context.Context) (dead []int) {
+	if c.health == nil {
+		return nil
+	}
+	failed := make([]bool, len(c.proxies))
+	sem := make(chan struct{}, proxyTestWorkers)
+	var wg sync.WaitGroup
+	for i := range c.proxies {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			failed[i] = !c.testClient(ctx, i)
+		}(i)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+	for i, f := range failed {
+		if f && c.health.remove(i) {
+			dead = append(dead, i)
+		}
+	}
+	return dead
+}
+
+// Whether a request through a client gets any response
+func (c *Checker) testClient(ctx context.Context, client int) bool {
+	req, err := c.request(ctx, CodeRequest{Base: c.apiBase, Code: testCode, Market: c.markets[0], Language: c.language, UserAgent: c.userAgents[0], Headers: c.headers})
+	if err != nil {
+		return false
+	}
+	resp, err := c.clients[client].Do(req)
+	if err != nil {
+		return false
+	}
+	closeBody(resp.Body)
+	return true
+}
+
+// Number of proxies that haven't been removed
+func (c *Checker) ProxiesLeft() int {
+	if c.health == nil {
+		return 0
+	}
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+	return c.health.alive
+}
@@ -0,0 +1,352 @@
+package checker
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returned by checkCode when the request was ratelimited
+type rateLimitError struct {
+	retryAfter time.Duration
+}
+
+func (e *rateLimitError) Error() string {
+	return "ratelimited"
+}
+
+// Response from the tokenDescriptions endpoint
+type TokenDescription struct {
+	TokenState string         `json:"tokenState"`
+	SubState   string         `json:"tokenSubState"`
+	TokenType  string         `json:"tokenType"`
+	Code       string         `json:"code"`
+	Products   []TokenProduct `json:"products"`
+}
+
+// Product a code redeems for
+type TokenProduct struct {
+	ProductID   string `json:"productId"`
+	ProductType string `json:"productType"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	// Only sent with supportMultiAvailabilities, either on the product or on each of its skus
+	Availabilities []TokenAvailability `json:"availabilities"`
+	Skus           []TokenSku          `json:"skus"`
+}
+
+// Sku of a product a code redeems for
+type TokenSku struct {
+	SkuID          string              `json:"skuId"`
+	Title          string              `json:"title"`
+	Availabilities []TokenAvailability `json:"availabilities"`
+}
+
+// One way a product is offered in the market, with its price
+type TokenAvailability struct {
+	AvailabilityID string      `json:"availabilityId"`
+	SkuID          string      `json:"skuId"`
+	Actions        []string    `json:"actions"`
+	Price          *TokenPrice `json:"price"`
+}
+
+// Price of an availability
+type TokenPrice struct {
+	CurrencyCode string  `json:"currencyCode"`
+	ListPrice    float64 `json:"listPrice"`
+	MSRP         float64 `json:"msrp"`
+}
+
+// Price shown for an availability like 59.99 USD, the MSRP when there is one since redeeming codes are often listed for 0
+func (p TokenPrice) String() string {
+	price := p.MSRP
+	if price == 0 {
+		price = p.ListPrice
+	}
+	return strings.TrimSpace(strconv.FormatFloat(price, 'f', 2, 64) + " " + p.CurrencyCode)
+}
+
+// Every availability in the response, from the products and their skus
+func (t TokenDescription) availabilities() []TokenAvailability {
+	var availabilities []TokenAvailability
+	for _, product := range t.Products {
+		availabilities = append(availabilities, product.Availabilities...)
+		for _, sku := range product.Skus {
+			for _, availability := range sku.Availabilities {
+				if availability.SkuID == "" {
+					availability.SkuID = sku.SkuID
+				}
+				availabilities = append(availabilities, availability)
+			}
+		}
+	}
+	return availabilities
+}
+
+// Price of the first availability that has one, empty when the response has none
+func (t TokenDescription) price() string {
+	for _, availability := range t.availabilities() {
+		if availability.Price != nil {
+			return availability.Price.String()
+		}
+	}
+	return ""
+}
+
+// Product types given to subscriptions like Game Pass rather than one time purchases
+var subscriptionTypes = map[string]struct{}{
+	"pass":         {},
+	"subscription": {},
+}
+
+// Describe what a code redeems for and whether it is a subscription like Game Pass or a trial
+func (t TokenDescription) describe() (description string, subscription bool) {
+	if strings.EqualFold(t.TokenType, "subscription") {
+		subscription = true
+	}
+	for _, product := range t.Products {
+		if description == "" {
+			description = product.Title
+			if description == "" {
+				description = product.Description
+			}
+		}
+		if _, ok := subscriptionTypes[strings.ToLower(product.ProductType)]; ok {
+			subscription = true
+		}
+		if strings.Contains(strings.ToLower(product.Title), "game pass") {
+			subscription = true
+		}
+	}
+	return description, subscription
+}
+
+// Known tokenState values and the status they are saved as
+var tokenStates = map[string]string{
+	"Active":      "valid",
+	"Redeemed":    "used",
+	"Pending":     "pending",
+	"Refundable":  "pending",
+	"Expired":     "expired",
+	"Revoked":     "invalid",
+	"Deactivated": "invalid",
+	"Disabled":    "invalid",
+	"Cancelled":   "invalid",
+}
+
+// tokenSubState values of redeemed codes that aren't final yet
+var pendingSubStates = map[string]bool{
+	"pending":    true,
+	"refundable": true,
+	"refunded":   true,
+}
+
+// Details from the response of a checked code
+type tokenInfo struct {
+	httpStatus     int
+	tokenState     string
+	body           string // raw response, only kept for unknown codes
+	url            string // request URL, for verbose logging
+	raw            string // raw response, for verbose logging
+	description    string // title of the product the code redeems for
+	subscription   bool
+	price          string // like 59.99 USD, when the response has availabilities
+	availabilities []TokenAvailability
+}
+
+// Endpoint codes are checked against unless Config.APIBase is set
+const DefaultAPIBase = "https://purchase.mp.microsoft.com/v7.0/tokenDescriptions/"
+
+// Check a single code, status is one of valid, used, pending, expired, invalid, ratelimited, blocked, unauthorized, retry or unknown
+func checkCode(ctx context.Context, r CodeRequest, client *http.Client, request RequestBuilder, classify Classifier) (status string, info tokenInfo, err error) {
+
+	// Malformed codes are invalid without wasting a request, Check already returns before getting here
+	if !IsValidCodeFormat(r.Code) {
+		return "invalid", info, nil
+	}
+
+	// Sending request
+	req, err := request(ctx, r)
+	if err != nil {
+		return "", info, err
+	}
+	info.url = req.URL.String()
+	resp, err := client.Do(req)
+	if err != nil {
+		// No response to read, let the worker retry
+		return "retry", info, err
+	}
+	status, info, err = parseResponse(resp, classify)
+	info.url = req.URL.String()
+	return status, info, err
+}
+
+// Build the tokenDescriptions request for checking a code, r.Headers override the built in ones
+func newCodeRequest(ctx context.Context, r CodeRequest) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", r.Base+url.PathEscape(r.Code)+"?market="+url.QueryEscape(r.Market)+"&language="+url.QueryEscape(r.Language)+"&supportMultiAvailabilities=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("accept", "application/json, text/javascript, */*; q=0.01")
+	req.Header.Add("accept-encoding", "gzip, deflate")
+	req.Header.Add("accept-language", "en-US,en;q=0.8")
+	req.Header.Add("authorization", r.WLID)
+	req.Header.Add("origin", "https://www.microsoft.com")
+	req.Header.Add("referer", "https://www.microsoft.com/")
+	req.Header.Add("sec-fetch-dest", "empty")
+	req.Header.Add("sec-fetch-mode", "cors")
+	req.Header.Add("sec-fetch-site", "same-site")
+	req.Header.Add("sec-gpc", "1")
+	req.Header.Add("user-agent", r.UserAgent)
+	for name, value := range r.Headers {
+		// An empty value drops a built in header
+		if value == "" {
+			req.Header.Del(name)
+		} else {
+			req.Header.Set(name, value)
+		}
+	}
+	return req, nil
+}
+
+// Read a response and classify it, with classify first when it isn't nil, closing its body
+func parseResponse(resp *http.Response, classify Classifier) (status string, info tokenInfo, err error) {
+	defer closeBody(resp.Body)
+	info.httpStatus = resp.StatusCode
+	body := &bodyReader{r: resp.Body}
+	content, err := readBody(body, resp.Header)
+	if err != nil {
+		if body.err != nil {
+			// The connection failed partway through the body, let the worker retry
+			return "retry", info, err
+		}
+		return "", info, err
+	}
+	status, info, err = classifyWith(classify, resp.StatusCode, resp.Header, content)
+	info.raw = string(content)
+	return status, info, err
+}
+
+// Classify a response by its status code and body
+func classifyResponse(statusCode int, header http.Header, content []byte) (status string, info tokenInfo, err error) {
+	info.httpStatus = statusCode
+
+	// Checking for ratelimit
+	if statusCode == 429 {
+		return "ratelimited", info, &rateLimitError{retryAfter: parseRetryAfter(header)}
+	}
+
+	// Captcha and challenge pages mean the requests are being blocked
+	if strings.HasPrefix(header.Get("Content-Type"), "text/html") || bytes.HasPrefix(bytes.TrimSpace(content), []byte("<")) {
+		return "blocked", info, errors.New("blocked by a challenge page")
+	}
+
+	// Parsing json
+	var token TokenDescription
+	if err := json.Unmarshal(content, &token); err != nil {
+		return "", info, fmt.Errorf("unexpected response (%s): %s", err, content)
+	}
+	info.tokenState = token.TokenState
+	info.description, info.subscription = token.describe()
+	info.availabilities = token.availabilities()
+	info.price = token.price()
+
+	// Checking response, anything unrecognized is kept with its body as unknown
+	if token.TokenState != "" {
+		if status, ok := tokenStates[token.TokenState]; ok {
+			// Redeemed codes still in their pending or refund window may become available again
+			if status == "used" && pendingSubStates[strings.ToLower(token.SubState)] {
+				status = "pending"
+			}
+			return status, info, nil
+		}
+		info.body = string(content)
+		return "unknown", info, nil
+	} else if token.Code != "" {
+		if token.Code == "NotFound" {
+			return "invalid", info, nil
+		} else if token.Code == "Unauthorized" {
+			return "unauthorized", info, nil
+		}
+		info.body = string(content)
+		return "unknown", info, nil
+	}
+	return "", info, errors.New(string(content))
+}
+
+// Close a response body, reading a little of what's left first so the connection can be reused
+// instead of a new one being opened for every code
+func closeBody(body io.ReadCloser) {
+	io.Copy(ioutil.Discard, io.LimitReader(body, 64<<10))
+	body.Close()
+}
+
+// Body that records the error of a failed read, to tell a dropped connection from a bad response
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// Most bytes of a response that are read, real ones are a few KB so anything bigger is a broken or hostile endpoint
+const maxBodySize = 1 << 20
+
+// Read the response body, decompressing it if needed, up to maxBodySize
+func readBody(body io.Reader, header http.Header) ([]byte, error) {
+	reader := body
+	switch strings.ToLower(header.Get("Content-Encoding")) {
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	case "deflate":
+		// Deflate should be zlib wrapped but some servers send it raw
+		buffered := bufio.NewReader(body)
+		if magic, err := buffered.Peek(2); err == nil && magic[0]&0x0f == 8 && (uint16(magic[0])<<8|uint16(magic[1]))%31 == 0 {
+			zr, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, err
+			}
+			defer zr.Close()
+			reader = zr
+		} else {
+			fr := flate.NewReader(buffered)
+			defer fr.Close()
+			reader = fr
+		}
+	case "br":
+		return nil, errors.New("brotli encoded responses are not supported")
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(reader, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxBodySize {
+		return nil, errors.New("response larger than " + strconv.Itoa(maxBodySize>>20) + "MB")
+	}
+	return content, nil
+}
@@ -0,0 +1,291 @@
+package checker
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mockCode = "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE"
+
+// Mock tokenDescriptions endpoint, the response is picked by the mock query parameter
+func newMockServer(t *testing.T) *httptest.Server {
+	responses := map[string]func(w http.ResponseWriter){
+		"ACTIVE": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Active"}`))
+		},
+		"REDEEMED": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Redeemed"}`))
+		},
+		"PENDING": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Redeemed","tokenSubState":"Refundable"}`))
+		},
+		"EXPIRED": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Expired"}`))
+		},
+		"REVOKED": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Revoked"}`))
+		},
+		"NOTFOUND": func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"NotFound"}`))
+		},
+		"UNAUTHORIZED": func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"code":"Unauthorized"}`))
+		},
+		"RATELIMITED": func(w http.ResponseWriter) {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		},
+		"GZIP": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(`{"tokenState":"Active"}`))
+			gz.Close()
+		},
+		"STRANGE": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Quarantined"}`))
+		},
+		"HTML": func(w http.ResponseWriter) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><body>Please verify you are a human</body></html>`))
+		},
+		"GAMEPASS": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Active","products":[{"productId":"CFQ7TTC0KHS0","productType":"Pass","title":"Xbox Game Pass Ultimate"}]}`))
+		},
+		"PRICED": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Active","products":[{"productId":"9NBLGGH4R315","title":"Minecraft","skus":[{"skuId":"0010","availabilities":[{"availabilityId":"9QQ6","actions":["Redeem"],"price":{"currencyCode":"USD","listPrice":0,"msrp":29.99}}]}]}]}`))
+		},
+		"HUGE": func(w http.ResponseWriter) {
+			w.Write([]byte(`{"tokenState":"Active","padding":"` + strings.Repeat("x", 2<<20) + `"}`))
+		},
+		"GARBAGE": func(w http.ResponseWriter) {
+			w.Write([]byte(`oops`))
+		},
+		"CUT": func(w http.ResponseWriter) {
+			// Dropping the connection halfway through the promised body
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n{\"tokenState\":"))
+			conn.Close()
+		},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") != "WLID1.0=test" {
+			t.Errorf("authorization header = %q", r.Header.Get("authorization"))
+		}
+		if r.Header.Get("x-test") != "1" || r.Header.Get("sec-gpc") != "" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		if r.URL.Query().Get("market") != "US" {
+			t.Errorf("market = %q", r.URL.Query().Get("market"))
+		}
+		respond, ok := responses[r.URL.Query().Get("mock")]
+		if !ok {
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		respond(w)
+	}))
+}
+
+// Send a request for the mocked response to the server and classify it
+func checkMock(t *testing.T, server *httptest.Server, mock string) (string, tokenInfo, error) {
+	req, err := newCodeRequest(context.Background(), CodeRequest{Base: server.URL + "/", Code: mockCode, Market: "US", Language: "en-US", WLID: "WLID1.0=test", UserAgent: "test", Headers: map[string]string{"x-test": "1", "sec-gpc": ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := req.URL.Query()
+	query.Set("mock", mock)
+	req.URL.RawQuery = query.Encode()
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	return parseResponse(resp, nil)
+}
+
+func TestParseResponse(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		mock       string
+		status     string
+		httpStatus int
+	}{
+		{"ACTIVE", "valid", 200},
+		{"REDEEMED", "used", 200},
+		{"PENDING", "pending", 200},
+		{"EXPIRED", "expired", 200},
+		{"REVOKED", "invalid", 200},
+		{"NOTFOUND", "invalid", 404},
+		{"UNAUTHORIZED", "unauthorized", 401},
+		{"RATELIMITED", "ratelimited", 429},
+		{"GZIP", "valid", 200},
+		{"STRANGE", "unknown", 200},
+		{"HTML", "blocked", 200},
+	}
+	for _, test := range tests {
+		status, info, _ := checkMock(t, server, test.mock)
+		if status != test.status {
+			t.Errorf("%s: status = %q, want %q", test.mock, status, test.status)
+		}
+		if info.httpStatus != test.httpStatus {
+			t.Errorf("%s: http status = %d, want %d", test.mock, info.httpStatus, test.httpStatus)
+		}
+	}
+}
+
+func TestParseResponseRateLimit(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	_, _, err := checkMock(t, server, "RATELIMITED")
+	rle, ok := err.(*rateLimitError)
+	if !ok {
+		t.Fatalf("err = %v, want a rateLimitError", err)
+	}
+	if rle.retryAfter != 7*time.Second {
+		t.Errorf("retry after = %s, want 7s", rle.retryAfter)
+	}
+}
+
+func TestParseResponseUnknownKeepsBody(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	_, info, err := checkMock(t, server, "STRANGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.tokenState != "Quarantined" || info.body != `{"tokenState":"Quarantined"}` {
+		t.Errorf("info = %+v", info)
+	}
+}
+
+func TestParseResponseSubscription(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	status, info, err := checkMock(t, server, "GAMEPASS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "valid" || !info.subscription || info.description != "Xbox Game Pass Ultimate" {
+		t.Errorf("status = %q, info = %+v", status, info)
+	}
+
+	_, info, _ = checkMock(t, server, "ACTIVE")
+	if info.subscription || info.description != "" {
+		t.Errorf("one time code info = %+v", info)
+	}
+}
+
+func TestParseResponseAvailabilities(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	status, info, err := checkMock(t, server, "PRICED")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != "valid" || info.price != "29.99 USD" || info.description != "Minecraft" {
+		t.Errorf("status = %q, info = %+v", status, info)
+	}
+	if len(info.availabilities) != 1 || info.availabilities[0].SkuID != "0010" || info.availabilities[0].AvailabilityID != "9QQ6" {
+		t.Errorf("availabilities = %+v", info.availabilities)
+	}
+
+	_, info, _ = checkMock(t, server, "GAMEPASS")
+	if info.price != "" || len(info.availabilities) != 0 {
+		t.Errorf("info without availabilities = %+v", info)
+	}
+}
+
+func TestParseResponseUnexpected(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	status, _, err := checkMock(t, server, "GARBAGE")
+	if err == nil {
+		t.Errorf("status = %q, want an error", status)
+	}
+}
+
+func TestParseResponseTooLarge(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	_, _, err := checkMock(t, server, "HUGE")
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("err = %v, want the response to be too large", err)
+	}
+}
+
+func TestParseResponseCutOff(t *testing.T) {
+	server := newMockServer(t)
+	defer server.Close()
+
+	status, _, err := checkMock(t, server, "CUT")
+	if status != "retry" || err == nil {
+		t.Errorf("status = %q, err = %v, want a retry", status, err)
+	}
+	// A bad or oversized body is still final
+	for _, mock := range []string{"GARBAGE", "HUGE"} {
+		if status, _, _ := checkMock(t, server, mock); status == "retry" {
+			t.Errorf("%s status = %q, want it final", mock, status)
+		}
+	}
+}
+
+func TestCheckCodeMalformed(t *testing.T) {
+	// Never reaches the client, so none is needed
+	status, _, err := checkCode(context.Background(), CodeRequest{Base: DefaultAPIBase, Code: "not-a-code", Market: "US", Language: "en-US", WLID: "WLID1.0=test", UserAgent: "test"}, nil, nil, nil)
+	if status != "invalid" || err != nil {
+		t.Errorf("status = %q, err = %v, want invalid", status, err)
+	}
+}
+
+func TestCheckCodeAPIBase(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v7.0/tokenDescriptions/"+mockCode {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		w.Write([]byte(`{"tokenState":"Active"}`))
+	}))
+	defer server.Close()
+
+	status, _, err := checkCode(context.Background(), CodeRequest{Base: server.URL + "/v7.0/tokenDescriptions/", Code: mockCode, Market: "US", Language: "en-US", WLID: "WLID1.0=test", UserAgent: "test"}, server.Client(), newCodeRequest, nil)
+	if status != "valid" || err != nil {
+		t.Errorf("status = %q, err = %v, want valid", status, err)
+	}
+}
+
+// Body that records whether it was closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestParseResponseClosesBody(t *testing.T) {
+	for _, content := range []string{`{"tokenState":"Active"}`, `oops`, `<html></html>`} {
+		body := &closeRecorder{Reader: strings.NewReader(content)}
+		parseResponse(&http.Response{StatusCode: 200, Header: http.Header{}, Body: body}, nil)
+		if !body.closed {
+			t.Errorf("body %q wasn't closed", content)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package checker
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/proxy"
+)
+
+// Dials TLS connections with a Chrome ClientHello instead of Go's, through proxy when it isn't nil
+type mimicDialer struct {
+	dialer *net.Dialer
+	proxy  *url.URL
+	config *utls.Config // copied for each connection with ServerName set, nil for the defaults
+}
+
+// Open a connection to addr and do the TLS handshake like Chrome would
+func (d *mimicDialer) DialTLSContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	conn, err := d.dial(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	config := &utls.Config{}
+	if d.config != nil {
+		config = d.config.Clone()
+	}
+	config.ServerName = host
+
+	spec, err := utls.UTLSIdToSpec(utls.HelloChrome_Auto)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// Only offering HTTP/1.1 since the transport can't speak HTTP/2 over its own TLS connections,
+	// the extensions and their order stay the same so the fingerprint still matches Chrome
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = []string{"http/1.1"}
+		}
+	}
+	uconn := utls.UClient(conn, config, utls.HelloCustom)
+	if err := uconn.ApplyPreset(&spec); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := uconn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return uconn, nil
+}
+
+// Connect to addr directly or through the proxy
+func (d *mimicDialer) dial(ctx context.Context, network string, addr string) (net.Conn, error) {
+	if d.proxy == nil {
+		return d.dialer.DialContext(ctx, network, addr)
+	}
+	if d.proxy.Scheme == "socks5" || d.proxy.Scheme == "socks5h" {
+		socks, err := proxy.FromURL(d.proxy, d.dialer)
+		if err != nil {
+			return nil, err
+		}
+		return socks.(proxy.ContextDialer).DialContext(ctx, network, addr)
+	}
+
+	// HTTP proxies tunnel the connection with CONNECT
+	conn, err := d.dialer.DialContext(ctx, network, d.proxy.Host)
+	if err != nil {
+		return nil, err
+	}
+	if d.proxy.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: d.proxy.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	req := &http.Request{Method: "CONNECT", URL: &url.URL{Opaque: addr}, Host: addr, Header: http.Header{}}
+	if user := d.proxy.User; user != nil {
+		password, _ := user.Password()
+		req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(user.Username()+":"+password)))
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// The body isn't closed, after a CONNECT it would read into the tunnel
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.New("proxy refused the connection: " + resp.Status)
+	}
+	return conn, nil
+}
@@ -0,0 +1,61 @@
+package checker
+
+import (
+	"context"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestMimicDialer(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	// Proxy that tunnels CONNECT requests to the server
+	tunnel := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "CONNECT" || r.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+		conn.Close()
+		upstream.Close()
+	}))
+	defer tunnel.Close()
+	proxyURL, _ := url.Parse(tunnel.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+
+	for _, proxy := range []*url.URL{nil, proxyURL} {
+		// The server certificate is for 127.0.0.1 so the dialer is given its address directly
+		dialer := &mimicDialer{dialer: &net.Dialer{}, proxy: proxy, config: &utls.Config{RootCAs: roots}}
+		client := &http.Client{Transport: &http.Transport{DialTLSContext: dialer.DialTLSContext}}
+		req, _ := http.NewRequestWithContext(context.Background(), "GET", server.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("proxy %v: %v", proxy, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "HTTP/1.1" {
+			t.Errorf("proxy %v: proto = %q, want HTTP/1.1", proxy, body)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package checker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WLIDs in rotation, safe to use from every worker
+type wlidPool struct {
+	mu        sync.Mutex
+	wlids     []string
+	cooldowns map[string]time.Time // ratelimited WLIDs and when they can be used again
+	lastUsed  map[string]uint64    // pick number each WLID was last picked at, for spreading requests evenly
+	picks     uint64
+}
+
+// Wrap a token as WLID1.0="...", false if there is no token or it couldn't be a header value.
+// Pasted tokens are cleaned up first, an Authorization: prefix, quotes, escaped quotes and trailing ; or , are dropped.
+func ParseWLID(line string) (string, bool) {
+	token := trimWLID(strings.ReplaceAll(line, `\"`, `"`))
+	if strings.HasPrefix(strings.ToLower(token), "authorization:") {
+		token = trimWLID(token[len("authorization:"):])
+	}
+	if i := strings.Index(strings.ToLower(token), "wlid1.0="); i >= 0 {
+		token = token[i+len("WLID1.0="):]
+	}
+	token = trimWLID(token)
+	if token == "" || strings.ContainsAny(token, "\"' \t\r\n") {
+		return "", false
+	}
+	return "WLID1.0=\"" + token + "\"", true
+}
+
+// Strip the spaces, quotes and separators left around a pasted token
+func trimWLID(s string) string {
+	return strings.Trim(s, " \t\r\n\"';,")
+}
+
+func newWLIDPool(wlids []string) *wlidPool {
+	return &wlidPool{wlids: append([]string(nil), wlids...), cooldowns: map[string]time.Time{}, lastUsed: map[string]uint64{}}
+}
+
+// Pick the least recently used WLID that isn't cooling down, other than except unless it's the only one.
+// This goes round robin through the WLIDs so ratelimits are spread evenly across them.
+// When every WLID is cooling down the wait until the first is ready is returned instead.
+// False once every WLID has been removed.
+func (p *wlidPool) pickExcept(except string) (wlid string, wait time.Duration, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.wlids) == 0 {
+		return "", 0, false
+	}
+
+	now := time.Now()
+	var ready []string
+	var soonest time.Time
+	for _, w := range p.wlids {
+		until, cooling := p.cooldowns[w]
+		if !cooling || !until.After(now) {
+			delete(p.cooldowns, w)
+			ready = append(ready, w)
+		} else if soonest.IsZero() || until.Before(soonest) {
+			soonest = until
+		}
+	}
+	if len(ready) == 0 {
+		return "", soonest.Sub(now), true
+	}
+
+	pick := ""
+	for _, w := range ready {
+		if w == except && len(ready) > 1 {
+			continue
+		}
+		if pick == "" || p.lastUsed[w] < p.lastUsed[pick] {
+			pick = w
+		}
+	}
+	p.picks++
+	p.lastUsed[pick] = p.picks
+	return pick, 0, true
+}
+
+// Skip a ratelimited WLID in the rotation until its cooldown is over
+func (p *wlidPool) cooldown(wlid string, wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cooldowns[wlid] = time.Now().Add(wait)
+}
+
+// Every WLID still in the rotation
+func (p *wlidPool) all() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.wlids...)
+}
+
+// Take a WLID out of the rotation, returning how many are left
+func (p *wlidPool) remove(wlid string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, w := range p.wlids {
+		if w == wlid {
+			p.wlids = append(p.wlids[:i], p.wlids[i+1:]...)
+			delete(p.cooldowns, wlid)
+			delete(p.lastUsed, wlid)
+			break
+		}
+	}
+	return len(p.wlids)
+}
+
+// Well formed code that doesn't exist, used to test WLIDs
+const testCode = "00000-00000-00000-00000-00000"
+
+// Send a test request with each WLID and drop the ones that are unauthorized, dead holds their indexes in Config.WLIDs.
+// The requests go through proxies that haven't been removed, so run ValidateProxies first.
+func (c *Checker) ValidateWLIDs(ctx context.Context) (dead []int) {
+	for i, wlid := range c.wlids.all() {
+		client, ok := c.pickClient(-1)
+		if !ok {
+			return dead
+		}
+		r := CodeRequest{Base: c.apiBase, Code: testCode, Market: c.markets[0], Language: c.language, WLID: wlid, UserAgent: c.userAgents[0], Headers: c.headers}
+		status, _, _ := checkCode(ctx, r, c.clients[client], c.request, c.classify)
+		if status == "unauthorized" {
+			c.wlids.remove(wlid)
+			dead = append(dead, i)
+		}
+		// Ratelimits and errors don't prove a WLID is dead so it is kept
+	}
+	return dead
+}
+
+// Number of WLIDs that haven't been removed
+func (c *Checker) WLIDsLeft() int {
+	return len(c.wlids.all())
+}
+
+// Shorten a WLID so it can be logged without leaking it
+func MaskWLID(wlid string) string {
+	if len(wlid) <= 16 {
+		return "***"
+	}
+	return wlid[:12] + "..." + wlid[len(wlid)-4:]
+}
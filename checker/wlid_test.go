@@ -0,0 +1,71 @@
+package checker
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseWLID(t *testing.T) {
+	tests := []struct {
+		line string
+		wlid string
+		ok   bool
+	}{
+		{`t=abc&p=`, `WLID1.0="t=abc&p="`, true},
+		{`WLID1.0="t=abc&p="`, `WLID1.0="t=abc&p="`, true},
+		{`WLID1.0=t=abc&p=`, `WLID1.0="t=abc&p="`, true},
+		{`WLID1.0=""`, "", false},
+		{`WLID1.0=`, "", false},
+		{`""`, "", false},
+		{`authorization: WLID1.0="t=abc&p="`, `WLID1.0="t=abc&p="`, true},
+		{`Authorization: t=abc&p=`, `WLID1.0="t=abc&p="`, true},
+		{`"WLID1.0=\"t=abc&p=\"";`, `WLID1.0="t=abc&p="`, true},
+		{`'t=abc&p=',`, `WLID1.0="t=abc&p="`, true},
+		{` wlid1.0="t=abc&p=" ; `, `WLID1.0="t=abc&p="`, true},
+		{`t=abc def`, "", false},
+		{`Authorization:`, "", false},
+	}
+	for _, test := range tests {
+		wlid, ok := ParseWLID(test.line)
+		if wlid != test.wlid || ok != test.ok {
+			t.Errorf("ParseWLID(%q) = %q, %v, want %q, %v", test.line, wlid, ok, test.wlid, test.ok)
+		}
+	}
+}
+
+func TestWLIDPoolCooldown(t *testing.T) {
+	pool := newWLIDPool([]string{"a", "b"})
+	pool.cooldown("a", time.Minute)
+	for i := 0; i < 10; i++ {
+		if wlid, wait, ok := pool.pickExcept(""); !ok || wait != 0 || wlid != "b" {
+			t.Fatalf("pickExcept = %q, %s, %v, want b", wlid, wait, ok)
+		}
+	}
+	if left := pool.remove("b"); left != 1 {
+		t.Errorf("left = %d, want 1", left)
+	}
+	if _, wait, ok := pool.pickExcept(""); !ok || wait <= 0 {
+		t.Errorf("pickExcept with every WLID cooling down = %s, %v", wait, ok)
+	}
+}
+
+func TestWLIDPoolRoundRobin(t *testing.T) {
+	pool := newWLIDPool([]string{"a", "b", "c"})
+	var picked []string
+	for i := 0; i < 6; i++ {
+		wlid, _, _ := pool.pickExcept("")
+		picked = append(picked, wlid)
+	}
+	if strings.Join(picked, "") != "abcabc" {
+		t.Errorf("picked = %q, want each WLID in turn", picked)
+	}
+
+	// Skipped while cooling down, then picked once as the least recently used
+	pool.cooldown("a", time.Minute)
+	pool.pickExcept("")
+	pool.cooldowns["a"] = time.Now()
+	if wlid, _, _ := pool.pickExcept(""); wlid != "a" {
+		t.Errorf("pick after cooldown = %q, want the least recently used a", wlid)
+	}
+}
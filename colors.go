@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// Whether stdout is a terminal, escape codes only make sense on one
+var stdoutTerminal = term.IsTerminal(int(os.Stdout.Fd()))
+
+// Whether console output is colored, off with NO_COLOR set or when stdout is redirected
+var colorsEnabled = os.Getenv("NO_COLOR") == "" && stdoutTerminal
+
+// Wrap text in an ANSI color, or leave it as is when colors are off
+func paint(code string, text string) string {
+	if !colorsEnabled {
+		return text
+	}
+	return code + text + "\033[0m"
+}
+
+// Console colors
+func red(text string) string    { return paint("\033[31m", text) }
+func green(text string) string  { return paint("\033[32m", text) }
+func yellow(text string) string { return paint("\033[33m", text) }
+func cyan(text string) string   { return paint("\033[36m", text) }
+func gray(text string) string   { return paint("\033[90m", text) }
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"XboxChecker/checker"
+)
+
+// Settings for a run, loaded from the defaults, a config file, environment variables and then flags
+type Config struct {
+	WLIDPath            string            `json:"wlidPath"`
+	CodesPath           string            `json:"codesPath"`
+	ProxiesPath         string            `json:"proxiesPath"`
+	UserAgentsPath      string            `json:"userAgentsPath"`
+	OutputDir           string            `json:"outputDir"`
+	Market              string            `json:"market"`
+	Language            string            `json:"language"`
+	Workers             int               `json:"workers"`
+	Timeout             duration          `json:"timeout"`
+	MaxRetries          int               `json:"maxRetries"`
+	Webhook             string            `json:"webhook"`
+	Delay               string            `json:"delay"`
+	Format              string            `json:"format"`
+	CSVPath             string            `json:"csvPath"`
+	NoProgress          bool              `json:"noProgress"`
+	LogPath             string            `json:"logPath"`
+	Quiet               bool              `json:"quiet"`
+	MaskOutput          bool              `json:"maskOutput"`
+	DryRun              bool              `json:"-"`
+	OutValid            string            `json:"outValid"`
+	OutUsed             string            `json:"outUsed"`
+	OutInvalid          string            `json:"outInvalid"`
+	MergeValidUsed      bool              `json:"mergeValidUsed"`
+	Retries             int               `json:"retries"`
+	RPS                 float64           `json:"rps"`
+	APIBase             string            `json:"apiBase"`
+	Limit               int               `json:"limit"`
+	Shuffle             bool              `json:"shuffle"`
+	MaxRuntime          duration          `json:"maxRuntime"`
+	Verbose             bool              `json:"verbose"`
+	Headers             map[string]string `json:"headers"`
+	SummaryWebhook      string            `json:"summaryWebhook"`
+	CheckOne            string            `json:"-"`
+	SortOutput          bool              `json:"sortOutput"`
+	Stream              bool              `json:"stream"`
+	EndWait             duration          `json:"endWait"`
+	ErrorWait           duration          `json:"errorWait"`
+	NoWait              bool              `json:"noWait"`
+	Passes              int               `json:"passes"`
+	PassDelay           duration          `json:"passDelay"`
+	MimicTLS            bool              `json:"mimicTLS"`
+	Watch               bool              `json:"watch"`
+	PerProxyConcurrency int               `json:"perProxyConcurrency"`
+	RotateSize          string            `json:"rotateSize"`
+	Version             bool              `json:"-"`
+	SkipChecked         bool              `json:"skipChecked"`
+	RetryFile           string            `json:"retryFile"`
+	NoPause             bool              `json:"noPause"`
+	MaxProxyFailures    int               `json:"maxProxyFailures"`
+	DirectFallback      bool              `json:"directFallback"`
+	MetricsAddr         string            `json:"metricsAddr"`
+	RatelimitStatuses   string            `json:"ratelimitStatuses"`
+	CodesFromClipboard  bool              `json:"codesFromClipboard"`
+	ProgressJSON        bool              `json:"progressJSON"`
+	WLIDValue           string            `json:"wlidValue"`
+	NoInvalidOutput     bool              `json:"noInvalidOutput"`
+	Mode                string            `json:"mode"`
+	AutoThrottle        bool              `json:"autoThrottle"`
+	WebhookBatch        int               `json:"webhookBatch"`
+	WebhookInterval     duration          `json:"webhookInterval"`
+	MatchPrefix         string            `json:"matchPrefix"`
+	MatchRegex          string            `json:"matchRegex"`
+}
+
+// Default settings, matching the original hardcoded behavior
+func defaultConfig() Config {
+	return Config{
+		WLIDPath:          filepath.Join("input", "WLID.txt"),
+		CodesPath:         filepath.Join("input", "codes.txt"),
+		ProxiesPath:       filepath.Join("input", "proxies.txt"),
+		UserAgentsPath:    filepath.Join("input", "useragents.txt"),
+		OutputDir:         "output",
+		Market:            "US",
+		Language:          "en-US",
+		Workers:           1,
+		Timeout:           duration{30 * time.Second},
+		MaxRetries:        0,
+		Delay:             "0",
+		Format:            formatText,
+		Retries:           3,
+		EndWait:           duration{30 * time.Second},
+		ErrorWait:         duration{5 * time.Second},
+		PassDelay:         duration{30 * time.Second},
+		RotateSize:        "0",
+		MaxProxyFailures:  5,
+		RatelimitStatuses: "429,403,503",
+		Mode:              checker.DefaultMode,
+		WebhookBatch:      1,
+		WebhookInterval:   duration{10 * time.Second},
+	}
+}
+
+// Register a flag for each setting, writing straight into the config
+func (cfg *Config) bindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&cfg.WLIDPath, "wlid", cfg.WLIDPath, "file to read WLIDs from, - for stdin")
+	fs.StringVar(&cfg.WLIDValue, "wlid-value", cfg.WLIDValue, "check with this WLID instead of reading the WLID file, for trying a new one")
+	fs.StringVar(&cfg.CodesPath, "codes", cfg.CodesPath, "file to read codes from, a directory or glob like input/*.txt to read several, or - for stdin")
+	fs.BoolVar(&cfg.CodesFromClipboard, "codes-from-clipboard", cfg.CodesFromClipboard, "check the codes copied to the clipboard instead of reading the codes file")
+	fs.StringVar(&cfg.ProxiesPath, "proxies", cfg.ProxiesPath, "file to read proxies from")
+	fs.StringVar(&cfg.UserAgentsPath, "useragents", cfg.UserAgentsPath, "file with extra user agents to rotate through")
+	fs.StringVar(&cfg.OutputDir, "output-dir", cfg.OutputDir, "directory to write results to")
+	fs.StringVar(&cfg.Market, "market", cfg.Market, "market to check codes in, or a comma separated list tried in order")
+	fs.StringVar(&cfg.Language, "language", cfg.Language, "language sent with each request")
+	fs.StringVar(&cfg.OutValid, "out-valid", cfg.OutValid, "file to save valid codes to, defaults to working.txt in the output directory")
+	fs.StringVar(&cfg.OutUsed, "out-used", cfg.OutUsed, "file to save used codes to, defaults to used.txt in the output directory")
+	fs.StringVar(&cfg.OutInvalid, "out-invalid", cfg.OutInvalid, "file to save invalid codes to, defaults to invalid.txt in the output directory")
+	fs.BoolVar(&cfg.NoInvalidOutput, "no-invalid-output", cfg.NoInvalidOutput, "don't save invalid codes to any output file, they are still counted in the stats")
+	fs.BoolVar(&cfg.MergeValidUsed, "merge-valid-used", cfg.MergeValidUsed, "save used codes in the same file as valid codes")
+	fs.BoolVar(&cfg.SortOutput, "sort-output", cfg.SortOutput, "sort the text output files alphabetically once the run is over")
+	fs.StringVar(&cfg.RotateSize, "rotate-size", cfg.RotateSize, "move on to a numbered output file, like working.1.txt, once one reaches this size, like 50MB, 0 never rotates")
+	fs.StringVar(&cfg.Format, "format", cfg.Format, "output format: text files, json lines in results.jsonl, or both")
+	fs.BoolVar(&cfg.MaskOutput, "mask-output", cfg.MaskOutput, "hide the last two groups of every code in the output files")
+	fs.StringVar(&cfg.CSVPath, "csv", cfg.CSVPath, "also write every checked code to this CSV file")
+	fs.StringVar(&cfg.MetricsAddr, "metrics-addr", cfg.MetricsAddr, "address like :8080 to serve the progress of the run on, as JSON and Prometheus metrics")
+	fs.BoolVar(&cfg.NoProgress, "no-progress", cfg.NoProgress, "don't draw the progress bar, for log friendly output")
+	fs.BoolVar(&cfg.ProgressJSON, "progress-json", cfg.ProgressJSON, "write progress, results and log messages to stdout as JSON lines instead of the console output, for frontends")
+	fs.BoolVar(&cfg.Quiet, "quiet", cfg.Quiet, "only print valid codes, the progress bar and the summary")
+	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "log the URL, masked WLID, status code and response of every request")
+	fs.StringVar(&cfg.LogPath, "log", cfg.LogPath, "also write log lines to this file")
+	fs.StringVar(&cfg.MatchPrefix, "match-prefix", cfg.MatchPrefix, "only check codes that start with this, like AAAAA-B, the rest are skipped without being saved")
+	fs.StringVar(&cfg.MatchRegex, "match-regex", cfg.MatchRegex, "only check codes matching this regular expression, the rest are skipped without being saved")
+	fs.BoolVar(&cfg.Shuffle, "shuffle", cfg.Shuffle, "check the codes in a random order")
+	fs.BoolVar(&cfg.Stream, "stream", cfg.Stream, "read codes while checking instead of loading them all first, for huge files")
+	fs.BoolVar(&cfg.Watch, "watch", cfg.Watch, "keep checking codes as they are appended to the codes file until stopped")
+	fs.StringVar(&cfg.RetryFile, "retry-file", cfg.RetryFile, "check the codes in the errors file of an earlier run again, keeping only the ones that still fail")
+	fs.BoolVar(&cfg.SkipChecked, "skip-checked", cfg.SkipChecked, "skip codes already saved to the output files by an earlier run")
+	fs.IntVar(&cfg.Limit, "limit", cfg.Limit, "only check the first N codes, 0 for every code")
+	fs.StringVar(&cfg.CheckOne, "check-one", cfg.CheckOne, "check just this code and print the result, without reading the codes file")
+	fs.BoolVar(&cfg.Version, "version", cfg.Version, "print the version and build details, then exit")
+	fs.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "load and validate the input, then exit without sending any requests")
+	fs.StringVar(&cfg.Mode, "mode", cfg.Mode, "endpoint and rules codes are checked with: "+strings.Join(checker.ModeNames(), ", "))
+	fs.StringVar(&cfg.APIBase, "api-base", cfg.APIBase, "endpoint codes are checked against instead of the one for -mode, for mock servers or regional endpoints")
+	fs.DurationVar(&cfg.EndWait.Duration, "end-wait", cfg.EndWait.Duration, "time to keep the window open after finishing, 0 to exit straight away")
+	fs.DurationVar(&cfg.ErrorWait.Duration, "error-wait", cfg.ErrorWait.Duration, "time to keep the window open after an error, 0 to exit straight away")
+	fs.BoolVar(&cfg.NoWait, "no-wait", cfg.NoWait, "exit straight away after finishing or an error, for scripts")
+	fs.BoolVar(&cfg.MimicTLS, "mimic-tls", cfg.MimicTLS, "send a Chrome like TLS handshake instead of Go's, for fewer blocks")
+	fs.IntVar(&cfg.Workers, "workers", cfg.Workers, "number of codes to check at once")
+	fs.DurationVar(&cfg.Timeout.Duration, "timeout", cfg.Timeout.Duration, "timeout for each request")
+	fs.DurationVar(&cfg.MaxRuntime.Duration, "max-runtime", cfg.MaxRuntime.Duration, "stop cleanly after running this long, like 1h, 0 for no limit")
+	fs.StringVar(&cfg.RatelimitStatuses, "ratelimit-statuses", cfg.RatelimitStatuses, "comma separated status codes backed off and retried like a 429")
+	fs.IntVar(&cfg.MaxRetries, "max-retries", cfg.MaxRetries, "times a code is retried after a ratelimit, 0 for no limit")
+	fs.IntVar(&cfg.MaxProxyFailures, "max-proxy-failures", cfg.MaxProxyFailures, "network errors in a row before a proxy is taken out of rotation, 0 only removes the ones that fail the startup test")
+	fs.BoolVar(&cfg.DirectFallback, "direct-fallback", cfg.DirectFallback, "check without a proxy once every proxy was removed instead of stopping")
+	fs.IntVar(&cfg.PerProxyConcurrency, "per-proxy-concurrency", cfg.PerProxyConcurrency, "most requests sent through each proxy at once, 0 for no limit")
+	fs.BoolVar(&cfg.AutoThrottle, "auto-throttle", cfg.AutoThrottle, "wait longer between requests while many are ratelimited and less again once they aren't, on top of -delay")
+	fs.BoolVar(&cfg.NoPause, "no-pause", cfg.NoPause, "only cool down the ratelimited WLID instead of pausing every worker after a ratelimit")
+	fs.Float64Var(&cfg.RPS, "rps", cfg.RPS, "most requests sent per second across every worker, 0 for no limit")
+	fs.StringVar(&cfg.Delay, "delay", cfg.Delay, "milliseconds to wait before each request, or a random range like 500-1500")
+	fs.IntVar(&cfg.Passes, "passes", cfg.Passes, "extra passes over the codes that errored, until they resolve or the passes run out")
+	fs.DurationVar(&cfg.PassDelay.Duration, "pass-delay", cfg.PassDelay.Duration, "time to wait before each extra pass")
+	fs.IntVar(&cfg.Retries, "retries", cfg.Retries, "times a code is retried with another WLID and proxy after a network error")
+	fs.StringVar(&cfg.Webhook, "webhook", cfg.Webhook, "Discord webhook URL to notify when a valid code is found")
+	fs.IntVar(&cfg.WebhookBatch, "webhook-batch", cfg.WebhookBatch, "valid codes sent in one webhook message, up to 25, 1 sends each one straight away")
+	fs.DurationVar(&cfg.WebhookInterval.Duration, "webhook-interval", cfg.WebhookInterval.Duration, "longest time valid codes wait for a batch to fill before being sent")
+	fs.StringVar(&cfg.SummaryWebhook, "summary-webhook", cfg.SummaryWebhook, "Discord webhook URL to send a summary of the run to, defaults to -webhook")
+}
+
+// Environment variables read for headless setups and the flag each one sets
+var envFlags = map[string]string{
+	"XCC_WLID_PATH":             "wlid",
+	"XCC_CODES_PATH":            "codes",
+	"XCC_PROXIES_PATH":          "proxies",
+	"XCC_USERAGENTS_PATH":       "useragents",
+	"XCC_OUTPUT_DIR":            "output-dir",
+	"XCC_MARKET":                "market",
+	"XCC_LANGUAGE":              "language",
+	"XCC_WORKERS":               "workers",
+	"XCC_TIMEOUT":               "timeout",
+	"XCC_MAX_RETRIES":           "max-retries",
+	"XCC_RETRIES":               "retries",
+	"XCC_RPS":                   "rps",
+	"XCC_DELAY":                 "delay",
+	"XCC_WEBHOOK":               "webhook",
+	"XCC_FORMAT":                "format",
+	"XCC_CSV":                   "csv",
+	"XCC_NO_PROGRESS":           "no-progress",
+	"XCC_LOG":                   "log",
+	"XCC_QUIET":                 "quiet",
+	"XCC_MASK_OUTPUT":           "mask-output",
+	"XCC_OUT_VALID":             "out-valid",
+	"XCC_OUT_USED":              "out-used",
+	"XCC_OUT_INVALID":           "out-invalid",
+	"XCC_MERGE_VALID_USED":      "merge-valid-used",
+	"XCC_API_BASE":              "api-base",
+	"XCC_LIMIT":                 "limit",
+	"XCC_SHUFFLE":               "shuffle",
+	"XCC_MAX_RUNTIME":           "max-runtime",
+	"XCC_VERBOSE":               "verbose",
+	"XCC_SUMMARY_WEBHOOK":       "summary-webhook",
+	"XCC_STREAM":                "stream",
+	"XCC_END_WAIT":              "end-wait",
+	"XCC_ERROR_WAIT":            "error-wait",
+	"XCC_NO_WAIT":               "no-wait",
+	"XCC_PASSES":                "passes",
+	"XCC_PASS_DELAY":            "pass-delay",
+	"XCC_MIMIC_TLS":             "mimic-tls",
+	"XCC_WATCH":                 "watch",
+	"XCC_PER_PROXY_CONCURRENCY": "per-proxy-concurrency",
+	"XCC_ROTATE_SIZE":           "rotate-size",
+	"XCC_RETRY_FILE":            "retry-file",
+	"XCC_SKIP_CHECKED":          "skip-checked",
+	"XCC_NO_PAUSE":              "no-pause",
+	"XCC_MAX_PROXY_FAILURES":    "max-proxy-failures",
+	"XCC_DIRECT_FALLBACK":       "direct-fallback",
+	"XCC_METRICS_ADDR":          "metrics-addr",
+	"XCC_RATELIMIT_STATUSES":    "ratelimit-statuses",
+	"XCC_CODES_FROM_CLIPBOARD":  "codes-from-clipboard",
+	"XCC_PROGRESS_JSON":         "progress-json",
+	"XCC_WLID_VALUE":            "wlid-value",
+	"XCC_NO_INVALID_OUTPUT":     "no-invalid-output",
+	"XCC_MODE":                  "mode",
+	"XCC_AUTO_THROTTLE":         "auto-throttle",
+	"XCC_WEBHOOK_BATCH":         "webhook-batch",
+	"XCC_WEBHOOK_INTERVAL":      "webhook-interval",
+	"XCC_MATCH_PREFIX":          "match-prefix",
+	"XCC_MATCH_REGEX":           "match-regex",
+	"XCC_SORT_OUTPUT":           "sort-output",
+}
+
+// Load settings from XCC_ environment variables on top of the current ones
+func (cfg *Config) loadEnv() error {
+	// Setting the values through flags so they are parsed the same way
+	fs := flag.NewFlagSet("env", flag.ContinueOnError)
+	cfg.bindFlags(fs)
+	for env, name := range envFlags {
+		value, ok := os.LookupEnv(env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return errors.New("invalid " + env + ": " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Load settings from a JSON file on top of the current ones
+func (cfg *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return errors.New("invalid config " + path + ": " + err.Error())
+	}
+	return nil
+}
+
+// Split a comma separated list, dropping empty entries
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Parse a delay in milliseconds, either a single value or a min-max range
+func parseDelay(s string) (min time.Duration, max time.Duration, err error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "-", 2)
+	values := make([]time.Duration, len(parts))
+	for i, part := range parts {
+		ms, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || ms < 0 {
+			return 0, 0, errors.New("invalid delay " + s + ", expected milliseconds like 1000 or 500-1500")
+		}
+		values[i] = time.Duration(ms) * time.Millisecond
+	}
+	min, max = values[0], values[len(values)-1]
+	if max < min {
+		return 0, 0, errors.New("invalid delay " + s + ", the minimum is larger than the maximum")
+	}
+	return min, max, nil
+}
+
+// Units a size can end in
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+// Parse a size in bytes, optionally ending in KB, MB or GB
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("invalid size " + s + ", expected bytes or a size like 50MB")
+	}
+	return n * unit, nil
+}
+
+// Parse a comma separated list of HTTP status codes
+func parseStatuses(s string) ([]int, error) {
+	statuses := []int{}
+	for _, value := range splitList(s) {
+		status, err := strconv.Atoi(value)
+		if err != nil || status < 100 || status > 599 {
+			return nil, errors.New("invalid status code " + value + ", expected a list like 429,403,503")
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Duration that is written as a string like "30s" in JSON
+type duration struct {
+	time.Duration
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("durations must be strings like \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Time to keep the window open after an error, so double clicked runs can be read before closing
+var errorWait = 5 * time.Second
+
+// Waits before exiting for these settings, none with -no-wait
+func (cfg Config) waits() (end time.Duration, err time.Duration) {
+	if cfg.NoWait {
+		return 0, 0
+	}
+	return cfg.EndWait.Duration, cfg.ErrorWait.Duration
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("XCC_CODES_PATH", "codes/*.txt")
+	t.Setenv("XCC_WORKERS", "8")
+	t.Setenv("XCC_TIMEOUT", "10s")
+	t.Setenv("XCC_QUIET", "true")
+
+	cfg := defaultConfig()
+	if err := cfg.loadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CodesPath != "codes/*.txt" || cfg.Workers != 8 || cfg.Timeout.Duration != 10*time.Second || !cfg.Quiet {
+		t.Errorf("config = %+v", cfg)
+	}
+	if cfg.Market != "US" {
+		t.Errorf("market = %q, want the default", cfg.Market)
+	}
+}
+
+func TestLoadEnvInvalid(t *testing.T) {
+	t.Setenv("XCC_WORKERS", "many")
+
+	cfg := defaultConfig()
+	if err := cfg.loadEnv(); err == nil {
+		t.Error("expected an error for a non numeric XCC_WORKERS")
+	}
+}
+
+func TestParseDelay(t *testing.T) {
+	min, max, err := parseDelay("500-1500")
+	if err != nil || min != 500*time.Millisecond || max != 1500*time.Millisecond {
+		t.Errorf("parseDelay = %s, %s, %v", min, max, err)
+	}
+	if _, _, err := parseDelay("1500-500"); err == nil {
+		t.Error("expected an error when the minimum is larger")
+	}
+}
+
+func TestWaits(t *testing.T) {
+	cfg := defaultConfig()
+	if end, err := cfg.waits(); end != 30*time.Second || err != 5*time.Second {
+		t.Errorf("default waits = %s, %s", end, err)
+	}
+	cfg.NoWait = true
+	if end, err := cfg.waits(); end != 0 || err != 0 {
+		t.Errorf("waits with no wait = %s, %s", end, err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{"0": 0, "1024": 1024, "50MB": 50 << 20, "2 gb": 2 << 30, "10KB": 10 << 10}
+	for s, want := range tests {
+		if got, err := parseSize(s); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", s, got, err, want)
+		}
+	}
+	if _, err := parseSize("big"); err == nil {
+		t.Error("expected an error for a size without a number")
+	}
+}
+
+func TestParseStatuses(t *testing.T) {
+	statuses, err := parseStatuses("429, 403,503")
+	if err != nil || len(statuses) != 3 || statuses[1] != 403 {
+		t.Errorf("parseStatuses = %v, %v", statuses, err)
+	}
+	if statuses, err := parseStatuses(""); err != nil || statuses == nil || len(statuses) != 0 {
+		t.Errorf("empty list = %v, %v", statuses, err)
+	}
+	if _, err := parseStatuses("429,forbidden"); err == nil {
+		t.Error("expected an error for a status that isn't a number")
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// Clear console
+func clearConsole() {
+	if runtime.GOOS == "windows" {
+		cmd := exec.Command("cmd", "/c", "cls")
+		cmd.Stdout = os.Stdout
+		cmd.Run()
+		return
+	}
+	if stdoutTerminal {
+		fmt.Print("\033[2J\033[H")
+	}
+}
+
+// Set title with the current progress and counts
+func setProgressTitle(checked int, total int, stats StatsSnapshot) {
+	done := strconv.Itoa(checked) + " codes checked"
+	if total > 0 {
+		done = strconv.Itoa(checked) + "/" + strconv.Itoa(total) + " codes checked | " + strconv.Itoa(checked*100/total) + "% done"
+	}
+	setTitle("Xbox Code Checker | github.com/Tainted06/Xbox-Code-Checker | " + done + " | Valid: " + strconv.Itoa(stats.Valid) + " | Used: " + strconv.Itoa(stats.Used) + " | Invalid: " + strconv.Itoa(stats.Invalid))
+}
+
+// Change console title
+func setTitle(title string) {
+	// The title command would write into the JSON lines
+	if progressJSON != nil {
+		return
+	}
+	if runtime.GOOS == "windows" {
+		cmd := exec.Command("cmd", "/C", "title", title)
+		cmd.Stdout = os.Stdout
+		cmd.Run()
+		return
+	}
+	// Redirected output would get the escape code written into it
+	if stdoutTerminal {
+		fmt.Print("\033]0;" + title + "\007")
+	}
+}
@@ -1,3 +1,19 @@
 module XboxChecker
 
 go 1.19
+
+require (
+	github.com/atotto/clipboard v0.1.4
+	github.com/refraction-networking/utls v1.3.3
+	golang.org/x/net v0.11.0
+	golang.org/x/term v0.9.0
+	golang.org/x/time v0.3.0
+)
+
+require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/gaukas/godicttls v0.0.3 // indirect
+	github.com/klauspost/compress v1.16.6 // indirect
+	golang.org/x/crypto v0.10.0 // indirect
+	golang.org/x/sys v0.9.0 // indirect
+)
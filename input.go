@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"XboxChecker/checker"
+
+	"github.com/atotto/clipboard"
+)
+
+// Path that reads from stdin instead of a file
+const stdinPath = "-"
+
+// Codes path used for -codes-from-clipboard, which reads the clipboard instead of a file
+const clipboardPath = "(clipboard)"
+
+// Read the text in the clipboard, a variable so tests don't need one
+var readClipboard = clipboard.ReadAll
+
+// Check that the input files exist with an error saying where they go when they don't,
+// creating missing folders so new users only have to add the files
+func checkInputs(paths ...string) error {
+	var missing, created []string
+	for _, path := range paths {
+		if path == "" || path == stdinPath || path == clipboardPath || isGlob(path) {
+			continue
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			continue
+		}
+		missing = append(missing, path)
+		dir := filepath.Dir(path)
+		if _, err := os.Stat(dir); os.IsNotExist(err) && os.MkdirAll(dir, 0755) == nil {
+			created = append(created, dir)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	msg := "Couldn't find " + strings.Join(missing, " and ") + ", add your WLIDs and codes one per line and start it again"
+	if len(created) > 0 {
+		msg += ", the " + strings.Join(created, " and ") + " folder was created for them"
+	}
+	return errors.New(msg)
+}
+
+// Open an input file, stdin for - or the clipboard, as UTF-8 without a BOM
+func openInput(path string) (io.ReadCloser, error) {
+	var f io.ReadCloser = ioutil.NopCloser(os.Stdin)
+	if path == clipboardPath {
+		text, err := readClipboard()
+		if err != nil {
+			return nil, errors.New("couldn't read the clipboard: " + err.Error())
+		}
+		f = ioutil.NopCloser(strings.NewReader(text))
+	} else if path != stdinPath {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		f = file
+	}
+	r, err := decodeInput(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+// Strip a UTF-8 BOM and transcode UTF-16 to UTF-8, Windows editors save text files like this
+func decodeInput(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	bom, _ := buffered.Peek(3)
+	switch {
+	case bytes.HasPrefix(bom, []byte{0xef, 0xbb, 0xbf}):
+		buffered.Discard(3)
+		return buffered, nil
+	case bytes.HasPrefix(bom, []byte{0xff, 0xfe}):
+		return decodeUTF16(buffered, binary.LittleEndian)
+	case bytes.HasPrefix(bom, []byte{0xfe, 0xff}):
+		return decodeUTF16(buffered, binary.BigEndian)
+	}
+	return buffered, nil
+}
+
+// Read UTF-16 text after its BOM and convert it to UTF-8
+func decodeUTF16(r *bufio.Reader, order binary.ByteOrder) (io.Reader, error) {
+	r.Discard(2)
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[i*2:])
+	}
+	return strings.NewReader(string(utf16.Decode(units))), nil
+}
+
+// Read every non-empty line of a file, or stdin for -
+func readLines(path string) ([]string, error) {
+	var lines []string
+	err := eachLine(path, func(line string) bool {
+		lines = append(lines, line)
+		return true
+	})
+	return lines, err
+}
+
+// Call fn with every non-empty line of a file, or stdin for -, one at a time until it returns false
+func eachLine(path string, fn func(line string) bool) error {
+	f, err := openInput(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !fn(line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Check if a path is a glob pattern rather than a single file
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// Find the code files for a path, which can be a file, a directory of .txt files or a glob
+func codeFiles(path string, exclude ...string) ([]string, error) {
+	var matches []string
+	if path == stdinPath || path == clipboardPath {
+		return []string{path}, nil
+	} else if isGlob(path) {
+		var err error
+		if matches, err = filepath.Glob(path); err != nil {
+			return nil, err
+		}
+	} else if info, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		if matches, err = filepath.Glob(filepath.Join(path, "*.txt")); err != nil {
+			return nil, err
+		}
+	} else {
+		return []string{path}, nil
+	}
+
+	// Leaving out the other input files in case they match too
+	skip := make(map[string]struct{}, len(exclude))
+	for _, path := range exclude {
+		if abs, err := filepath.Abs(path); err == nil {
+			skip[abs] = struct{}{}
+		}
+	}
+	var files []string
+	for _, match := range matches {
+		abs, err := filepath.Abs(match)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := skip[abs]; ok {
+			continue
+		}
+		if info, err := os.Stat(match); err == nil && !info.IsDir() {
+			files = append(files, match)
+		}
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no code files found in " + path)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Filter for -match-prefix and -match-regex that codes have to pass both parts of, nil when neither is set.
+// Both are matched against the normalized code ignoring case.
+func codeMatcher(prefix string, pattern string) (func(code string) bool, error) {
+	if prefix == "" && pattern == "" {
+		return nil, nil
+	}
+	prefix = strings.ToUpper(strings.TrimSpace(prefix))
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile("(?i)" + pattern); err != nil {
+			return nil, errors.New("invalid match regex: " + err.Error())
+		}
+	}
+	return func(code string) bool {
+		return strings.HasPrefix(code, prefix) && (re == nil || re.MatchString(code))
+	}, nil
+}
+
+// Read the codes from every code file
+func readCodes(files []string) ([]string, error) {
+	var codes []string
+	for _, file := range files {
+		lines, err := readLines(file)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, lines...)
+	}
+	return codes, nil
+}
+
+// Call fn with every normalized code in the files without loading them all at once, skipping checked codes
+// and the ones match returns false for when it isn't nil.
+// Stops after limit codes or once fn returns false, a limit of 0 reads every code.
+func streamCodes(files []string, checked map[string]struct{}, match func(code string) bool, limit int, fn func(code string) bool) error {
+	sent := 0
+	stopped := false
+	for _, file := range files {
+		err := eachLine(file, func(line string) bool {
+			code := checker.NormalizeCode(line)
+			if code == "" {
+				return true
+			}
+			if _, ok := checked[code]; ok {
+				return true
+			}
+			if match != nil && !match(code) {
+				return true
+			}
+			if limit > 0 && sent >= limit {
+				stopped = true
+				return false
+			}
+			sent++
+			if !fn(code) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if err != nil || stopped {
+			return err
+		}
+	}
+	return nil
+}
+
+// Call fn with every normalized code in path and then with the ones appended to it, checking for new lines every
+// interval until ctx is done, limit codes were sent or fn returns false. Checked and repeated codes and the ones
+// match returns false for are skipped, and the file is read again from the start if it is truncated or replaced.
+func watchCodes(ctx context.Context, path string, checked map[string]struct{}, match func(code string) bool, limit int, interval time.Duration, fn func(code string) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	r := bufio.NewReader(f)
+	var offset int64
+	partial := ""
+	seen := map[string]struct{}{}
+	sent := 0
+	for {
+		line, err := r.ReadString('\n')
+		offset += int64(len(line))
+		if err == io.EOF {
+			// Keeping a line that is still being written until its newline arrives
+			partial += line
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return nil
+			}
+			opened, openedErr := f.Stat()
+			current, currentErr := os.Stat(path)
+			if openedErr == nil && currentErr == nil && (!os.SameFile(opened, current) || current.Size() < offset) {
+				reopened, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				f.Close()
+				f, r, offset, partial = reopened, bufio.NewReader(reopened), 0, ""
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		line = strings.TrimPrefix(partial+line, "\ufeff")
+		partial = ""
+
+		code := checker.NormalizeCode(line)
+		if code == "" {
+			continue
+		}
+		if _, ok := checked[code]; ok {
+			continue
+		}
+		if _, ok := seen[code]; ok {
+			continue
+		}
+		if match != nil && !match(code) {
+			continue
+		}
+		if limit > 0 && sent >= limit {
+			return nil
+		}
+		seen[code] = struct{}{}
+		sent++
+		if !fn(code) {
+			return nil
+		}
+	}
+}
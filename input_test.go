@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+func TestReadLinesEncodings(t *testing.T) {
+	text := "WLID1.0=first\r\nWLID1.0=second\r\n"
+	utf16le, utf16be := []byte{0xff, 0xfe}, []byte{0xfe, 0xff}
+	for _, unit := range utf16.Encode([]rune(text)) {
+		utf16le = append(utf16le, byte(unit), byte(unit>>8))
+		utf16be = append(utf16be, byte(unit>>8), byte(unit))
+	}
+	files := map[string][]byte{
+		"utf8":     []byte(text),
+		"utf8 bom": append([]byte{0xef, 0xbb, 0xbf}, text...),
+		"utf16le":  utf16le,
+		"utf16be":  utf16be,
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name+".txt")
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			t.Fatal(err)
+		}
+		lines, err := readLines(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 2 || lines[0] != "WLID1.0=first" || lines[1] != "WLID1.0=second" {
+			t.Errorf("%s: lines = %q", name, lines)
+		}
+	}
+}
+
+func TestCodeFilesExclude(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "WLID.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := codeFiles(filepath.Join(dir, "*.txt"), filepath.Join(dir, "WLID.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || filepath.Base(files[0]) != "a.txt" || filepath.Base(files[1]) != "b.txt" {
+		t.Errorf("files = %q", files)
+	}
+}
+
+func TestStreamCodes(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(a, []byte("aaaaabbbbbcccccdddddeeeee\n\nAAAAA-BBBBB-CCCCC-DDDDD-11111 # note\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte("AAAAA-BBBBB-CCCCC-DDDDD-22222\nAAAAA-BBBBB-CCCCC-DDDDD-33333\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	checked := map[string]struct{}{"AAAAA-BBBBB-CCCCC-DDDDD-11111": {}}
+
+	var codes []string
+	err := streamCodes([]string{a, b}, checked, nil, 2, func(code string) bool {
+		codes = append(codes, code)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 2 || codes[0] != "AAAAA-BBBBB-CCCCC-DDDDD-EEEEE" || codes[1] != "AAAAA-BBBBB-CCCCC-DDDDD-22222" {
+		t.Errorf("codes = %q", codes)
+	}
+}
+
+func TestWatchCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "codes.txt")
+	if err := os.WriteFile(path, []byte("AAAAA-BBBBB-CCCCC-DDDDD-11111\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	codes := make(chan string)
+	done := make(chan error)
+	go func() {
+		done <- watchCodes(ctx, path, nil, nil, 0, 10*time.Millisecond, func(code string) bool {
+			codes <- code
+			return true
+		})
+	}()
+	if code := <-codes; code != "AAAAA-BBBBB-CCCCC-DDDDD-11111" {
+		t.Fatalf("first code = %q", code)
+	}
+
+	// A line is only read once its newline is written, repeats are skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("AAAAA-BBBBB-CCCCC-DDDDD-11111\nAAAAA-BBBBB-")
+	time.Sleep(50 * time.Millisecond)
+	f.WriteString("CCCCC-DDDDD-22222\n")
+	if code := <-codes; code != "AAAAA-BBBBB-CCCCC-DDDDD-22222" {
+		t.Errorf("appended code = %q", code)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckInputs(t *testing.T) {
+	dir := t.TempDir()
+	wlid := filepath.Join(dir, "WLID.txt")
+	os.WriteFile(wlid, []byte("t=abc\n"), 0600)
+	if err := checkInputs(wlid, stdinPath); err != nil {
+		t.Errorf("existing file: %v", err)
+	}
+
+	codes := filepath.Join(dir, "input", "codes.txt")
+	err := checkInputs(wlid, codes)
+	if err == nil || !strings.Contains(err.Error(), codes) {
+		t.Fatalf("err = %v, want it to name %s", err, codes)
+	}
+	if info, err := os.Stat(filepath.Dir(codes)); err != nil || !info.IsDir() {
+		t.Errorf("input folder wasn't created: %v", err)
+	}
+}
+
+func TestReadCodesClipboard(t *testing.T) {
+	defer func(read func() (string, error)) { readClipboard = read }(readClipboard)
+	readClipboard = func() (string, error) {
+		return "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA\r\nBBBBB-BBBBB-BBBBB-BBBBB-BBBBB\n", nil
+	}
+	files, err := codeFiles(clipboardPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := readCodes(files)
+	if err != nil || len(codes) != 2 || codes[1] != "BBBBB-BBBBB-BBBBB-BBBBB-BBBBB" {
+		t.Errorf("codes = %q, %v", codes, err)
+	}
+	if progressPath(clipboardPath) != "" {
+		t.Error("the clipboard has a progress file")
+	}
+}
+
+func TestSaveRemaining(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "remaining.txt")
+	codes := []string{"AAAAA-BBBBB-CCCCC-DDDDD-11111", "AAAAA-BBBBB-CCCCC-DDDDD-22222", "AAAAA-BBBBB-CCCCC-DDDDD-33333"}
+	left, err := saveRemaining(path, codes, map[string]struct{}{codes[1]: {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(path)
+	if left != 2 || string(content) != codes[0]+"\n"+codes[2]+"\n" {
+		t.Errorf("saved %d codes: %q", left, content)
+	}
+}
+
+func TestProgressWaitsForFlush(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "codes.progress")
+	prog, err := openProgress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog.done("AAAAA-BBBBB-CCCCC-DDDDD-11111")
+	codes := prog.take()
+	prog.done("AAAAA-BBBBB-CCCCC-DDDDD-22222")
+	if content, _ := os.ReadFile(path); len(content) != 0 {
+		t.Errorf("saved before flushing: %q", content)
+	}
+	if err := prog.Flush(codes); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "AAAAA-BBBBB-CCCCC-DDDDD-11111\n" {
+		t.Errorf("saved %q after flushing", content)
+	}
+	prog.putBack([]string{"AAAAA-BBBBB-CCCCC-DDDDD-33333"})
+	if err := prog.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "AAAAA-BBBBB-CCCCC-DDDDD-11111\nAAAAA-BBBBB-CCCCC-DDDDD-33333\nAAAAA-BBBBB-CCCCC-DDDDD-22222\n" {
+		t.Errorf("saved %q after closing", content)
+	}
+}
+
+func TestCodeMatcher(t *testing.T) {
+	if match, err := codeMatcher("", ""); match != nil || err != nil {
+		t.Errorf("matcher without a filter = %v, %v", match != nil, err)
+	}
+	match, err := codeMatcher("aaaaa-b", "1$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for code, want := range map[string]bool{
+		"AAAAA-BBBBB-CCCCC-DDDDD-11111": true,
+		"AAAAA-BBBBB-CCCCC-DDDDD-11112": false,
+		"AAAAA-CBBBB-CCCCC-DDDDD-11111": false,
+	} {
+		if got := match(code); got != want {
+			t.Errorf("match(%q) = %v, want %v", code, got, want)
+		}
+	}
+	if _, err := codeMatcher("", "("); err == nil {
+		t.Error("no error for an invalid regex")
+	}
+}
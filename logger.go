@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Log levels
+const (
+	levelInfo  = "INFO"
+	levelWarn  = "WARN"
+	levelError = "ERROR"
+	levelDebug = "DEBUG"
+)
+
+// Writes log lines to the console and optionally a log file
+type logger struct {
+	mu      sync.Mutex
+	file    *os.File
+	quiet   bool
+	verbose bool // print DEBUG lines
+}
+
+// Shared logger used by every part of the checker
+var logs = &logger{}
+
+// Start also writing to a log file
+func (l *logger) openFile(path string) error {
+	f, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.file = f
+	l.mu.Unlock()
+	return nil
+}
+
+// Close the log file
+func (l *logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Print a line to the console in color and write it to the log file with its level
+func (l *logger) log(level string, color func(string) string, a ...interface{}) {
+	l.write(level, color, true, a...)
+}
+
+// Write a line to the log file, and to the console if console is set
+func (l *logger) write(level string, color func(string) string, console bool, a ...interface{}) {
+	msg := strings.TrimSuffix(fmt.Sprintln(a...), "\n")
+	if console && progressJSON != nil {
+		progressJSON.log(level, msg)
+	} else if console {
+		bar.println(color(msg))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		msg := strings.TrimSpace(msg)
+		fmt.Fprintf(l.file, "%s [%s] %s\n", time.Now().Format(time.RFC3339), level, msg)
+	}
+}
+
+// Log at INFO level, color is the console color
+func logInfo(color func(string) string, a ...interface{}) {
+	logs.log(levelInfo, color, a...)
+}
+
+// Log at WARN level
+func logWarn(a ...interface{}) {
+	logs.log(levelWarn, yellow, a...)
+}
+
+// Log at ERROR level
+func logError(a ...interface{}) {
+	logs.log(levelError, red, a...)
+}
+
+// Log the result of a single code, hidden from the console in quiet mode
+func logCode(level string, color func(string) string, a ...interface{}) {
+	logs.write(level, color, !logs.quiet, a...)
+}
+
+// Log at DEBUG level, only when verbose
+func logDebug(a ...interface{}) {
+	if logs.verbose {
+		logs.log(levelDebug, gray, a...)
+	}
+}
@@ -2,174 +2,1001 @@ package main
 
 // Imports
 import (
-	"encoding/json"
-	"io/ioutil"
-	"strconv"
+	"context"
+	"flag"
+	"fmt"
 	"math/rand"
-	"net/http"
-	"os/exec"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"bufio"
+	"sync"
+	"sync/atomic"
 	"time"
-	"fmt"
-	"os"
+
+	"XboxChecker/checker"
 )
 
+// Result of checking a single code, or an event while checking one
+type result struct {
+	checker.Result
+	wait  time.Duration // backoff of a ratelimited or blocked event
+	left  int           // WLIDs left for a wlidremoved event, proxies left for a proxyremoved one
+	proxy string        // host of the proxy for a proxyremoved event
+}
+
 func main() {
+	// Parsing flags
+	cfg := defaultConfig()
+	envErr := cfg.loadEnv()
+	configPath := flag.String("config", os.Getenv("XCC_CONFIG"), "JSON file to load settings from")
+	cfg.bindFlags(flag.CommandLine)
+	flag.Parse()
+	_, errorWait = cfg.waits()
 
-	// Clear console
-	cmd := exec.Command("cmd", "/c", "cls")
-	cmd.Stdout = os.Stdout
-	cmd.Run()
+	// Deciding on JSON output before anything is logged, so even the first errors are JSON events
+	startProgressJSON(&cfg)
+	if envErr != nil {
+		logError(envErr)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	if cfg.Version {
+		fmt.Println(versionString())
+		return
+	}
 
-	// Title screen
-	setTitle("Xbox Code Checker | Made by Tainted | github.com/Tainted06/Xbox-Code-Checker")
-	fmt.Println("\033[36m █ █ ██▄ ███ █ █    ███ ███ ██▄ ███    ███ █ █ ███ ███ █ █ ███ ███\n  █  █▄█ █ █  █     █   █ █ █ █ █▄     █   █▄█ █▄  █   ██▄ █▄  █▄ \n █ █ █▄█ █▄█ █ █    ███ █▄█ ███ █▄▄    ███ █ █ █▄▄ ███ █ █ █▄▄ █ █\n By: Tainted [tainted.dev] [github.com/Tainted06]\n\033[0m")
+	// Loading config, environment variables and flags still take precedence over it
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			logError(err)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		cfg.loadEnv()
+		flag.Parse()
+		_, errorWait = cfg.waits()
+		startProgressJSON(&cfg)
+	}
 
-	// Reading WLID(s)
-	wlid, err := os.Open("input\\WLID.txt")
+	// Double clicking the exe asks for the common settings instead of needing flags
+	if progressJSON == nil && showMenu() {
+		if err := runMenu(&cfg, os.Stdin, os.Stdout); err != nil {
+			logError(err)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	delayMin, delayMax, err := parseDelay(cfg.Delay)
+	if err != nil {
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	rotateSize, err := parseSize(cfg.RotateSize)
+	if err != nil {
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	ratelimitStatuses, err := parseStatuses(cfg.RatelimitStatuses)
 	if err != nil {
-		fmt.Println("\033[31m", err)
-		time.Sleep(5 * time.Second)
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	if len(splitList(cfg.Market)) == 0 {
+		cfg.Market = defaultConfig().Market
+	}
+	outOpts := outputOptions{
+		dir:     cfg.OutputDir,
+		format:  cfg.Format,
+		csvPath: cfg.CSVPath,
+		mask:    cfg.MaskOutput,
+		paths: map[string]string{
+			"valid":   cfg.OutValid,
+			"used":    cfg.OutUsed,
+			"invalid": cfg.OutInvalid,
+		},
+		mergeValidUsed: cfg.MergeValidUsed,
+		sort:           cfg.SortOutput,
+		market:         len(splitList(cfg.Market)) > 1,
+		maxSize:        rotateSize,
+		noInvalid:      cfg.NoInvalidOutput,
+	}
+	mode, ok := checker.Modes[cfg.Mode]
+	if !ok {
+		logError("invalid mode " + cfg.Mode + ", expected " + strings.Join(checker.ModeNames(), ", "))
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	if cfg.APIBase == "" {
+		cfg.APIBase = mode.APIBase
+	} else if !strings.HasSuffix(cfg.APIBase, "/") {
+		cfg.APIBase += "/"
+	}
+	logs.quiet = cfg.Quiet
+	logs.verbose = cfg.Verbose
+	if cfg.LogPath != "" {
+		if err := logs.openFile(cfg.LogPath); err != nil {
+			logError(err)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		defer logs.Close()
+	}
+
+	if progressJSON == nil {
+		// Clear console
+		clearConsole()
+
+		// Title screen
+		setTitle("Xbox Code Checker | Made by Tainted | github.com/Tainted06/Xbox-Code-Checker")
+		fmt.Println(cyan(" █ █ ██▄ ███ █ █    ███ ███ ██▄ ███    ███ █ █ ███ ███ █ █ ███ ███\n  █  █▄█ █ █  █     █   █ █ █ █ █▄     █   █▄█ █▄  █   ██▄ █▄  █▄ \n █ █ █▄█ █▄█ █ █    ███ █▄█ ███ █▄▄    ███ █ █ █▄▄ ███ █ █ █▄▄ █ █\n By: Tainted [tainted.dev] [github.com/Tainted06]\n " + versionString() + "\n"))
+	}
+
+	// Codes copied to the clipboard are read in place of the codes file
+	if cfg.CodesFromClipboard {
+		if cfg.RetryFile != "" || cfg.Watch {
+			logError("-codes-from-clipboard can't be used with -retry-file or -watch")
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		cfg.CodesPath = clipboardPath
+	}
+
+	// Saying where the files go instead of failing on a path error, like when the zip was just unpacked
+	var required []string
+	if cfg.WLIDValue == "" {
+		required = append(required, cfg.WLIDPath)
+	}
+	if cfg.RetryFile != "" {
+		required = append(required, cfg.RetryFile)
+	} else if cfg.CheckOne == "" {
+		required = append(required, cfg.CodesPath)
+	}
+	if err := checkInputs(required...); err != nil {
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	if cfg.CheckOne == "" {
+		if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+			logError("Couldn't create the output folder:", err)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+	}
+
+	// Reading WLID(s)
+	if cfg.WLIDValue == "" && cfg.WLIDPath == stdinPath && cfg.CodesPath == stdinPath {
+		logError("WLIDs and codes can't both be read from stdin")
+		time.Sleep(errorWait)
 		os.Exit(1)
 	}
-	fileScannerWLIDs := bufio.NewScanner(wlid)
-	fileScannerWLIDs.Split(bufio.ScanLines)
 	var wlids []string
-	for fileScannerWLIDs.Scan() {
-		if strings.Contains(fileScannerWLIDs.Text(), "WLID1.0=") {
-			wlids = append(wlids, string(fileScannerWLIDs.Text()))
-		} else {
-			wlids = append(wlids, "WLID1.0=\"" + string(fileScannerWLIDs.Text()) + "\"")
-		}		
+	var wlidLines []int
+	if cfg.WLIDValue != "" {
+		// A single WLID from the command line, for trying a new one before adding it to the file
+		wlid, ok := checker.ParseWLID(cfg.WLIDValue)
+		if !ok {
+			logError("-wlid-value doesn't have a valid token")
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		wlids, wlidLines = []string{wlid}, []int{0}
+	} else {
+		var malformed int
+		wlids, wlidLines, malformed, err = loadWLIDs(cfg.WLIDPath)
+		if err != nil {
+			logError(err)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		if malformed > 0 {
+			logWarn(" [!] Skipped " + strconv.Itoa(malformed) + " WLID lines without a valid token")
+		}
+		if len(wlids) == 0 {
+			logError("No WLIDs found in " + cfg.WLIDPath)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
 	}
-	if len(wlids) == 0 {
-		fmt.Println("\033[31m No WLIDs found in input\\WLID.txt")
-		time.Sleep(5 * time.Second)
+
+	// Reading proxies
+	proxies, err := loadProxies(cfg.ProxiesPath)
+	if err != nil {
+		logError(err)
+		time.Sleep(errorWait)
 		os.Exit(1)
 	}
+	if len(proxies) > 0 {
+		logInfo(cyan, " [*] Loaded "+strconv.Itoa(len(proxies))+" proxies")
+	}
 
-	// Reading codes
-	codes_file, err := os.Open("input\\codes.txt")
+	// Reading user agents
+	userAgents, err := loadUserAgents(cfg.UserAgentsPath)
 	if err != nil {
-		fmt.Println("\033[31m", err)
-		time.Sleep(5 * time.Second)
+		logError(err)
+		time.Sleep(errorWait)
 		os.Exit(1)
 	}
 
-	// Go through each line
-	fileScannerCodes := bufio.NewScanner(codes_file)
-	fileScannerCodes.Split(bufio.ScanLines)
+	// Checking a single code from the command line without reading any code files
+	if cfg.CheckOne != "" {
+		settings := checkerConfig(cfg, wlids, proxies, userAgents, delayMin, delayMax, ratelimitStatuses)
+		settings.OnEvent = logEvent
+		if !runCheckOne(cfg, settings) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if cfg.Watch {
+		// Watching reads the codes as they are written, the same as streaming them
+		if cfg.Passes > 0 {
+			logError("-passes waits for every code to be checked and can't be used with -watch")
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		cfg.Stream = true
+	}
+	if cfg.RetryFile != "" {
+		if cfg.Stream {
+			// New errors are appended to the file while it would still be read
+			logError("-retry-file reads the whole file first and can't be used with -stream or -watch")
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		cfg.CodesPath = cfg.RetryFile
+	}
+	if cfg.Stream && cfg.Shuffle {
+		logError("-shuffle needs every code in memory and can't be used with -stream or -watch")
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+
+	// Skipping codes checked by a previous run
+	alreadyChecked, err := loadProgress(progressPath(cfg.CodesPath))
+	if err != nil {
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	if cfg.SkipChecked {
+		if cfg.MaskOutput {
+			logWarn(" [!] -skip-checked can't match masked codes in the output files, they will be checked again")
+		}
+		saved, err := outOpts.checkedCodes()
+		if err != nil {
+			logError(err)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		for code := range saved {
+			alreadyChecked[code] = struct{}{}
+		}
+	}
+
+	// Reading codes, which can be spread over several files
+	files, err := codeFiles(cfg.CodesPath, cfg.WLIDPath, cfg.ProxiesPath, cfg.UserAgentsPath, progressPath(cfg.CodesPath))
+	if err != nil {
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	if cfg.Watch && (len(files) != 1 || files[0] != cfg.CodesPath || cfg.CodesPath == stdinPath) {
+		logError("-watch needs a single codes file, not stdin, a directory or a glob")
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
 	var codes []string
-	for fileScannerCodes.Scan() {
-		codes = append(codes, string(fileScannerCodes.Text()))
+	total, duplicates, malformed := 0, 0, 0
+	match, err := codeMatcher(cfg.MatchPrefix, cfg.MatchRegex)
+	if err != nil {
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	limited := false
+	if cfg.Stream {
+		// Counting the codes for the progress bar without keeping them, stdin can only be read once and watched files keep growing
+		if (cfg.CodesPath != stdinPath && !cfg.Watch) || cfg.DryRun {
+			err := streamCodes(files, alreadyChecked, match, 0, func(code string) bool {
+				total++
+				if !checker.IsValidCodeFormat(code) {
+					malformed++
+				}
+				return true
+			})
+			if err != nil {
+				logError(err)
+				time.Sleep(errorWait)
+				os.Exit(1)
+			}
+			if total == 0 {
+				logError("No codes to check in " + cfg.CodesPath)
+				time.Sleep(errorWait)
+				os.Exit(1)
+			}
+		}
+		if cfg.Limit > 0 && cfg.Limit < total {
+			logInfo(cyan, " [*] Limited to the first "+strconv.Itoa(cfg.Limit)+" of "+strconv.Itoa(total)+" codes")
+			limited = true
+			total = cfg.Limit
+		}
+	} else {
+		codes, err = readCodes(files)
+		if err != nil {
+			logError(err)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+		var repaired int
+		codes, duplicates, repaired = checker.NormalizeCodes(codes)
+		if duplicates > 0 {
+			logInfo(cyan, " [*] Skipped "+strconv.Itoa(duplicates)+" duplicate codes")
+		}
+		if repaired > 0 {
+			logInfo(cyan, " [*] Repaired "+strconv.Itoa(repaired)+" codes that had spaces instead of dashes")
+		}
+		if len(codes) == 0 {
+			logError("No codes found in " + cfg.CodesPath)
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+
+		// Leaving out the codes that don't match -match-prefix or -match-regex without saving them anywhere
+		if match != nil {
+			matching := codes[:0]
+			for _, code := range codes {
+				if match(code) {
+					matching = append(matching, code)
+				}
+			}
+			if len(matching) == 0 {
+				logError("No codes in " + cfg.CodesPath + " match -match-prefix or -match-regex")
+				time.Sleep(errorWait)
+				os.Exit(1)
+			}
+			logInfo(cyan, " [*] Skipped "+strconv.Itoa(len(codes)-len(matching))+" codes that don't match the filter")
+			codes = matching
+		}
+
+		if len(alreadyChecked) > 0 {
+			remaining := codes[:0]
+			for _, code := range codes {
+				if _, ok := alreadyChecked[code]; !ok {
+					remaining = append(remaining, code)
+				}
+			}
+			if cfg.SkipChecked {
+				logInfo(cyan, " [*] Skipped "+strconv.Itoa(len(codes)-len(remaining))+" codes already in the output files")
+			} else {
+				logInfo(cyan, " [*] Resuming, skipped "+strconv.Itoa(len(codes)-len(remaining))+" already checked codes")
+			}
+			codes = remaining
+		}
+
+		// Randomizing the order so overlapping lists and codes from the same batch are spread out
+		if cfg.Shuffle {
+			r := rand.New(rand.NewSource(time.Now().UnixNano()))
+			r.Shuffle(len(codes), func(i, j int) {
+				codes[i], codes[j] = codes[j], codes[i]
+			})
+		}
+
+		// Only checking the first codes, the rest are left for another run
+		limited = cfg.Limit > 0 && cfg.Limit < len(codes)
+		if limited {
+			logInfo(cyan, " [*] Limited to the first "+strconv.Itoa(cfg.Limit)+" of "+strconv.Itoa(len(codes))+" codes")
+			codes = codes[:cfg.Limit]
+		}
+		for _, code := range codes {
+			if !checker.IsValidCodeFormat(code) {
+				malformed++
+			}
+		}
+		total = len(codes)
+	}
+
+	// Only validating input without sending any requests
+	if cfg.DryRun {
+		err := checkFormat(cfg.Format)
+		if err != nil {
+			logError(err)
+		}
+		logInfo(cyan, " [*] Dry run, no requests were sent")
+		logInfo(cyan, " [*] WLIDs: "+strconv.Itoa(len(wlids))+" | Proxies: "+strconv.Itoa(len(proxies))+" | User agents: "+strconv.Itoa(len(userAgents)))
+		// Streamed codes aren't deduplicated so there is no count to show
+		dupes := strconv.Itoa(duplicates)
+		if cfg.Stream {
+			dupes = "n/a (stream)"
+		}
+		logInfo(cyan, " [*] Codes to check: "+strconv.Itoa(total)+" | Malformed: "+strconv.Itoa(malformed)+" | Duplicates: "+dupes)
+		if err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Stopping on Ctrl+C, cancelling requests in flight, a second Ctrl+C exits straight away
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if cfg.MaxRuntime.Duration > 0 {
+		// Stopping the same way once the max runtime is up
+		ctx, cancel = context.WithTimeout(ctx, cfg.MaxRuntime.Duration)
+		defer cancel()
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		<-sigs
+		signal.Stop(sigs)
+		logWarn(" [*] Stopping, cancelling codes being checked... [Ctrl+C again to exit now]")
+		cancel()
+	}()
+
+	// Waiting out a ratelimit from the last run before sending anything
+	ratelimitPath := filepath.Join(cfg.OutputDir, "ratelimit.json")
+	ratelimitUntil, err := loadRatelimit(ratelimitPath)
+	if err != nil {
+		logWarn(" [!] " + err.Error())
+	}
+	if wait := time.Until(ratelimitUntil); wait > 0 {
+		logWarn(" [!] Still ratelimited from the last run, waiting " + wait.Round(time.Second).String() + " before checking")
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	// Events from the workers are handled with the results
+	results := make(chan result)
+	settings := checkerConfig(cfg, wlids, proxies, userAgents, delayMin, delayMax, ratelimitStatuses)
+	settings.OnEvent = func(ev checker.Event) {
+		if ev.Type == "request" {
+			logRequest(ev)
+			return
+		}
+		results <- result{Result: checker.Result{Code: ev.Code, Market: ev.Market, Status: ev.Type}, wait: ev.Wait, left: ev.Left, proxy: ev.Proxy}
+	}
+	c := checker.New(settings)
+
+	// Dropping proxies that can't connect before they fail any codes, the WLIDs are tested through the rest
+	if len(proxies) > 0 {
+		logInfo(cyan, " [*] Testing "+strconv.Itoa(len(proxies))+" proxies...")
+		for _, i := range c.ValidateProxies(ctx) {
+			logWarn(" [!] Removed dead proxy " + proxies[i].Host)
+		}
+		if c.ProxiesLeft() == 0 {
+			if !cfg.DirectFallback {
+				logError(" [-] Error: Every proxy is dead, check your proxies or use -direct-fallback")
+				time.Sleep(errorWait)
+				os.Exit(1)
+			}
+			logWarn(" [!] Every proxy is dead, checking without one")
+		}
+	}
+
+	// Dropping expired WLIDs before touching any codes
+	logInfo(cyan, " [*] Checking "+strconv.Itoa(len(wlids))+" WLIDs...")
+	for _, i := range c.ValidateWLIDs(ctx) {
+		if cfg.WLIDValue != "" {
+			logWarn(" [!] The WLID from -wlid-value is invalid")
+		} else {
+			logWarn(" [!] Removed invalid WLID on line " + strconv.Itoa(wlidLines[i]) + " of " + cfg.WLIDPath)
+		}
 	}
-	if len(codes) == 0 {
-		fmt.Println("\033[31m No codes found in input\\codes.txt")
-		time.Sleep(5 * time.Second)
+	if c.WLIDsLeft() == 0 {
+		logError(" [-] Error: Every WLID is invalid, get a new one from redeem.microsoft.com")
+		time.Sleep(errorWait)
 		os.Exit(1)
 	}
 
-	// Starting amount
-	startamt := len(codes)
-	// Iterating through codes
-	for {
+	// Errors from the retried file are dropped at the end if it is also the errors file of this run
+	retrySize := int64(0)
+	if cfg.RetryFile != "" && cfg.Format != formatJSON {
+		retryInfo, retryErr := os.Stat(cfg.RetryFile)
+		errorsInfo, errorsErr := os.Stat(outOpts.textPath("error"))
+		if retryErr == nil && errorsErr == nil && os.SameFile(retryInfo, errorsInfo) {
+			retrySize = retryInfo.Size()
+		}
+	}
 
-		// Set title
-		percent_done := strconv.Itoa((startamt - len(codes)) * 100 / startamt)
-		setTitle("Xbox Code Checker | github.com/Tainted06/Xbox-Code-Checker | " + strconv.Itoa(startamt - len(codes)) + "/" + strconv.Itoa(startamt) + " codes checked | " + percent_done + "% done")
+	// Opening output files
+	prog, err := openProgress(progressPath(cfg.CodesPath))
+	if err != nil {
+		logError(err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+	out, err := newResultWriter(outOpts)
+	if err != nil {
+		logError("Failed to open output files:", err)
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
 
-		// Check if codes is empty
-		if len(codes) != 0 {
+	// Listening before any codes are checked so a taken port stops the run straight away
+	var metricsListener net.Listener
+	if cfg.MetricsAddr != "" {
+		metricsListener, err = net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			logError("Failed to serve metrics:", err)
+			out.Close()
+			prog.Close()
+			time.Sleep(errorWait)
+			os.Exit(1)
+		}
+	}
 
-			// Checking if codes is less than 18 characters
-			if len(codes[0]) < 18 {
-				fmt.Println("\033[31m", " [-] "+codes[0]+" is invalid!")
-				f, _ := os.OpenFile("output\\invalid.txt", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-				defer f.Close()
-				f.WriteString(codes[0] + "\n")
+	// Flushing results every second. The checked codes are taken before the output is flushed,
+	// so progress only ever saves codes whose results are already on disk
+	stopFlush := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				codes := prog.take()
+				if err := out.Flush(); err != nil {
+					logError(" [!] Failed to save results:", err)
+					prog.putBack(codes)
+					continue
+				}
+				if err := prog.Flush(codes); err != nil {
+					logError(" [!] Failed to save progress:", err)
+				}
+			case <-stopFlush:
+				return
+			}
+		}
+	}()
 
-				// Remove code from slice
-				codes = codes[1:]
+	// Codes read from stdin or the clipboard have no progress file, the ones checked are kept to save the rest on a fatal error
+	var checkedNow map[string]struct{}
+	if prog.path == "" && !cfg.Stream {
+		checkedNow = make(map[string]struct{}, len(codes))
+	}
+	var webhooks *webhookBatcher
+	if cfg.Webhook != "" {
+		webhooks = newWebhookBatcher(cfg.Webhook, cfg.WebhookBatch, cfg.WebhookInterval.Duration)
+	}
 
-			} else {
+	// Stopping everything on an error that ends the run, saving what was checked so running again resumes
+	fatal := func(msg string, checked int) {
+		logError(msg)
+		cancel()
+		close(stopFlush)
+		<-flushed
+		if webhooks != nil {
+			webhooks.Close()
+		}
+		if err := out.Close(); err != nil {
+			logError(" [!] Failed to close output files:", err)
+		}
+		if err := prog.Close(); err != nil {
+			logError(" [!] Failed to save progress:", err)
+		}
+		if prog.path != "" {
+			logInfo(cyan, " [*] Stopped after checking "+strconv.Itoa(checked)+" codes, run again to resume")
+		} else if checkedNow != nil {
+			path := filepath.Join(cfg.OutputDir, "remaining.txt")
+			if left, err := saveRemaining(path, codes, checkedNow); err != nil {
+				logError(" [!] Failed to save the unchecked codes:", err)
+			} else if left > 0 {
+				logInfo(cyan, " [*] Saved "+strconv.Itoa(left)+" unchecked codes to "+path+", check them with -codes "+path)
+			}
+		} else {
+			// Streamed codes aren't kept, so there's nothing to resume from
+			logInfo(cyan, " [*] Stopped after checking "+strconv.Itoa(checked)+" codes, the rest of the input wasn't checked")
+		}
+		time.Sleep(errorWait)
+		os.Exit(1)
+	}
+
+	// Starting workers
+	codesChan := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go worker(ctx, c, codesChan, results, &wg)
+	}
 
-			// Sending request
-			client := &http.Client{}
-			req, err1 := http.NewRequest("GET", "https://purchase.mp.microsoft.com/v7.0/tokenDescriptions/"+codes[0]+"?market=US&language=en-US&supportMultiAvailabilities=true", nil)
-			req.Header.Add("accept", "application/json, text/javascript, */*; q=0.01")
-			req.Header.Add("accept-encoding", "gzip, deflate, br")
-			req.Header.Add("accept-language", "en-US,en;q=0.8")
-			req.Header.Add("authorization", string(wlids[rand.Intn(len(wlids))]))
-			req.Header.Add("origin", "https://www.microsoft.com")
-			req.Header.Add("referer", "https://www.microsoft.com/")
-			req.Header.Add("sec-fetch-dest", "empty")
-			req.Header.Add("sec-fetch-mode", "cors")
-			req.Header.Add("sec-fetch-site", "same-site")
-			req.Header.Add("sec-gpc", "1")
-			req.Header.Add("user-agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/105.0.0.0 Safari/537.36")
-			resp, err2 := client.Do(req)
-
-			// Parsing json
-			content, err3 := (ioutil.ReadAll(resp.Body))
-			var json_content map[string]interface{}
-			json.Unmarshal([]byte(content), &json_content)
-
-			// Checking for ratelimit
-			if resp.StatusCode == 429 {
-				fmt.Println("\033[31m", " [-] Ratelimit! [Try adding more WLIDs or waiting for the ratelimit to finish]")
-				time.Sleep(5 * time.Second)
-			} else
-
-			// Checking response
-			{
-				if err1 != nil || err2 != nil || err3 != nil {
-					fmt.Println("\033[31m", " [-] Error: ", err1, err2, err3)
-				} else if strings.Contains(string(content), "tokenState") {
-					tknstate := json_content["tokenState"].(string)
-					if string(tknstate) == "Active" {
-						fmt.Println("\033[32m", " [+] "+codes[0][0:17]+"-XXXXX-XXXXX is valid!")
-						f, _ := os.OpenFile("output\\working.txt", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-						defer f.Close()
-						f.WriteString(codes[0] + "\n")
-					} else if string(tknstate) == "Redeemed" {
-						fmt.Println("\033[31m", " [-] "+codes[0][0:17]+"-XXXXX-XXXXX is used!")
-						f, _ := os.OpenFile("output\\used.txt", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-						defer f.Close()
-						f.WriteString(codes[0] + "\n")
-					}
-				} else if json_content["code"] != "undefined" {
-					if json_content["code"] == "NotFound" {
-						fmt.Println("\033[31m", " [-] "+codes[0][0:17]+"-XXXXX-XXXXX is invalid!")
-						f, _ := os.OpenFile("output\\invalid.txt", os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-						defer f.Close()
-						f.WriteString(codes[0] + "\n")
-					} else if json_content["code"] == "Unauthorized" {
-						fmt.Println("\033[31m", " [-] Error: Invalid WLID")
-						time.Sleep(5 * time.Second)
-						os.Exit(1)
-					}
-				} else {
-					fmt.Println("\033[31m", " [-] Error: "+string(content))
+	// Feeding codes to the workers, then the ones that errored again for each extra pass
+	var readFailed atomic.Bool
+	passes := newRetryPasses(cfg.Passes)
+	go func() {
+		defer close(codesChan)
+		send := func(code string) bool {
+			passes.sent()
+			select {
+			case codesChan <- code:
+				return true
+			case <-ctx.Done():
+				passes.handled()
+				return false
+			}
+		}
+		if !cfg.Stream {
+			for _, code := range codes {
+				if !send(code) {
+					return
+				}
+			}
+		} else if cfg.Watch {
+			logInfo(cyan, " [*] Watching "+cfg.CodesPath+" for new codes, press Ctrl+C to stop")
+			if err := watchCodes(ctx, cfg.CodesPath, alreadyChecked, match, cfg.Limit, time.Second, send); err != nil {
+				logError(" [!] Failed to watch codes, the rest are left for another run:", err)
+				readFailed.Store(true)
+			}
+		} else if err := streamCodes(files, alreadyChecked, match, cfg.Limit, send); err != nil {
+			logError(" [!] Failed to read codes, the rest are left for another run:", err)
+			readFailed.Store(true)
+		}
+		for {
+			pass, retry := passes.next()
+			if len(retry) == 0 || ctx.Err() != nil {
+				return
+			}
+			logInfo(cyan, " [*] Pass "+strconv.Itoa(pass+1)+"/"+strconv.Itoa(cfg.Passes+1)+", retrying "+strconv.Itoa(len(retry))+" codes that errored in "+cfg.PassDelay.String())
+			select {
+			case <-time.After(cfg.PassDelay.Duration):
+			case <-ctx.Done():
+				return
+			}
+			for _, code := range retry {
+				if !send(code) {
+					return
 				}
+			}
+		}
+	}()
 
-				// Remove code from slice
-				codes = codes[1:]
+	// Closing results once every worker is done
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
+	// Starting amount
+	startamt := total
+	checked := 0
+	stats := newStats()
+	if metricsListener != nil {
+		serveMetrics(metricsListener, stats, startamt)
+		logInfo(cyan, " [*] Serving metrics on http://"+metricsListener.Addr().String()+"/metrics")
+	}
+	setProgressTitle(checked, startamt, stats.Snapshot())
+	// Redirected output would fill up with frames of the bar, so it's only drawn on a console
+	bar.begin(startamt, !cfg.NoProgress && stdoutTerminal)
+	if progressJSON != nil {
+		progressJSON.progress(checked, startamt, stats.Snapshot())
+	}
+
+	// Handling results
+	for res := range results {
+		if res.Status == "ratelimited" {
+			logWarn(" [-] Ratelimit! Skipping the WLID for " + res.wait.String() + " [Try adding more WLIDs or waiting for the ratelimit to finish]")
+			if until := time.Now().Add(res.wait); until.After(ratelimitUntil) {
+				ratelimitUntil = until
+				if err := saveRatelimit(ratelimitPath, until); err != nil {
+					logError(" [!] Failed to save ratelimit:", err)
+				}
 			}
+			continue
 		}
-		} else {
-			break // Leave loop once all codes have been checked
+		if res.Status == "blocked" {
+			logWarn(" [!] Blocked by a captcha or challenge page, backing off for " + res.wait.String() + " [Try using proxies or lowering -rps]")
+			continue
 		}
+		if res.Status == "cancelled" {
+			// Left unchecked so resuming tries it again
+			passes.handled()
+			continue
+		}
+		if res.Status == "throttle" {
+			logThrottle(res.wait)
+			continue
+		}
+		if res.Status == "wlidremoved" {
+			logWarn(" [!] Removed an invalid WLID, " + strconv.Itoa(res.left) + " left")
+			continue
+		}
+		if res.Status == "proxyremoved" {
+			logWarn(" [!] Removed proxy " + res.proxy + " after " + strconv.Itoa(cfg.MaxProxyFailures) + " network errors in a row, " + strconv.Itoa(res.left) + " left")
+			if res.left == 0 && cfg.DirectFallback {
+				logWarn(" [!] Every proxy was removed, checking without one")
+			}
+			continue
+		}
+		if res.Status == "unauthorized" {
+			fatal(" [-] Error: Every WLID is invalid, get a new one from redeem.microsoft.com", checked)
+		}
+		if res.Err == checker.ErrNoProxies {
+			fatal(" [-] Error: Every proxy was removed after failing, check your proxies or use -direct-fallback", checked)
+		}
+
+		if res.Err != nil && passes.retry(res.Code) {
+			logCode(levelWarn, yellow, " [-] Error: "+res.Err.Error()+", retrying in the next pass")
+			passes.handled()
+			continue
+		}
+
+		if res.Err != nil {
+			logCode(levelError, red, " [-] Error: ", res.Err)
+			saveResult(out, res)
+		} else if res.Status == "valid" {
+			logInfo(green, " [+] "+checker.MaskCode(res.Code)+" is valid"+describe(res.Result)+" in "+res.Market+"!")
+			saveResult(out, res)
+			if webhooks != nil {
+				webhooks.add(res.Code, res.Description)
+			}
+		} else if res.Status == "used" {
+			logCode(levelInfo, red, " [-] "+checker.MaskCode(res.Code)+" is used!")
+			saveResult(out, res)
+		} else if res.Status == "pending" {
+			logCode(levelInfo, yellow, " [~] "+checker.MaskCode(res.Code)+" is redeemed but pending, it may become available again")
+			saveResult(out, res)
+		} else if res.Status == "expired" {
+			logCode(levelInfo, red, " [-] "+checker.MaskCode(res.Code)+" is expired!")
+			saveResult(out, res)
+		} else if res.Status == "unknown" {
+			logCode(levelWarn, yellow, " [?] "+checker.MaskCode(res.Code)+" has an unknown state, saved with its response for checking")
+			saveResult(out, res)
+		} else if res.Status == "invalid" {
+			logCode(levelInfo, red, " [-] "+checker.MaskCode(res.Code)+" is invalid!")
+			saveResult(out, res)
+		}
+
+		stats.add(res)
+
+		// Errored codes are left unchecked so resuming tries them again
+		if res.Err == nil {
+			if err := prog.done(res.Code); err != nil {
+				logError(" [!] Failed to save progress:", err)
+			}
+			if checkedNow != nil {
+				checkedNow[res.Code] = struct{}{}
+			}
+		}
+
+		passes.handled()
+
+		// Set title
+		checked++
+		setProgressTitle(checked, startamt, stats.Snapshot())
+		bar.update(checked)
+		if progressJSON != nil {
+			progressJSON.result(res, cfg.MaskOutput)
+			progressJSON.progress(checked, startamt, stats.Snapshot())
+		}
+	}
+	bar.end()
+
+	if webhooks != nil {
+		webhooks.Close()
+	}
+	close(stopFlush)
+	<-flushed
+	if retrySize > 0 && ctx.Err() == nil && !limited && !readFailed.Load() {
+		// Every code in the retried file was checked again, only the ones that failed this time are kept
+		out.DropRetried(retrySize)
+	}
+	if err := out.Close(); err != nil {
+		logError(" [!] Failed to close output files:", err)
+	}
+	interrupted := ctx.Err() != nil
+	stats.stop()
+	final := stats.Snapshot()
+	if progressJSON != nil {
+		progressJSON.progress(checked, startamt, final)
+	}
+	if err := final.save(filepath.Join(cfg.OutputDir, "stats.json")); err != nil {
+		logError(" [!] Failed to save stats:", err)
+	}
+	summaryWebhook := cfg.SummaryWebhook
+	if summaryWebhook == "" {
+		summaryWebhook = cfg.Webhook
+	}
+	if summaryWebhook != "" {
+		if err := sendSummaryWebhook(summaryWebhook, final, interrupted); err != nil {
+			logError(" [!] Failed to send summary webhook:", err)
+		}
+	}
+	if interrupted || limited || cfg.Watch || final.Errors > 0 || readFailed.Load() {
+		// Keeping progress so the next run only retries the unchecked codes, a watched file never runs out of them
+		prog.Close()
+	} else if err := prog.finish(); err != nil {
+		logError(" [!] Failed to remove progress file:", err)
+	}
+
+	if interrupted {
+		if ctx.Err() == context.DeadlineExceeded {
+			logWarn("\n [!] Reached the max runtime of " + cfg.MaxRuntime.String())
+		}
+		progress := strconv.Itoa(checked)
+		if startamt > 0 {
+			progress += "/" + strconv.Itoa(startamt)
+		}
+		logInfo(cyan, "\nStopped after checking "+progress+" codes, run again to resume")
+		logInfo(cyan, final.summary())
+		return
+	}
+	logInfo(cyan, "\nFinished checking codes!")
+	logInfo(cyan, final.summary())
+	endWait, _ := cfg.waits()
+	time.Sleep(endWait)
+}
+
+// Send everything on stdout as JSON lines once -progress-json is set
+func startProgressJSON(cfg *Config) {
+	if !cfg.ProgressJSON || progressJSON != nil {
+		return
+	}
+	// The bar and the title would get in the way, and the frontend reading them has its own window to keep open
+	progressJSON = newJSONStream(os.Stdout)
+	cfg.NoProgress = true
+	cfg.NoWait = true
+	_, errorWait = cfg.waits()
+}
+
+// What a valid code redeems for, for log lines
+func describe(res checker.Result) string {
+	kind := ""
+	if res.Subscription {
+		kind = "subscription"
+	}
+	if res.Description != "" {
+		kind = res.Description
 	}
+	if res.Price != "" {
+		kind = strings.TrimSpace(kind + " " + res.Price)
+	}
+	if kind == "" {
+		return ""
+	}
+	return " (" + kind + ")"
+}
+
+// Library settings for the CLI config
+func checkerConfig(cfg Config, wlids []string, proxies []*url.URL, userAgents []string, delayMin time.Duration, delayMax time.Duration, ratelimitStatuses []int) checker.Config {
+	return checker.Config{
+		WLIDs:      wlids,
+		Proxies:    proxies,
+		UserAgents: userAgents,
+		Markets:    splitList(cfg.Market),
+		Language:   cfg.Language,
+		Timeout:    cfg.Timeout.Duration,
+		Retries:    cfg.Retries,
+		MaxRetries: cfg.MaxRetries,
+		DelayMin:   delayMin,
+		DelayMax:   delayMax,
+		RPS:        cfg.RPS,
+		APIBase:    cfg.APIBase,
+		Mode:       checker.Modes[cfg.Mode],
+		Headers:    cfg.Headers,
+		MimicTLS:   cfg.MimicTLS,
+
+		PerProxyConcurrency: cfg.PerProxyConcurrency,
+		NoPause:             cfg.NoPause,
+		AutoThrottle:        cfg.AutoThrottle,
+		MaxProxyFailures:    cfg.MaxProxyFailures,
+		DirectFallback:      cfg.DirectFallback,
+		RatelimitStatuses:   ratelimitStatuses,
+
+		// Streamed and watched lists can be too big to keep every result in memory
+		NoCache: cfg.Stream || cfg.Watch,
+	}
+}
 
-	fmt.Println("\033[36m", "\nFinished checking codes!")
-	time.Sleep(30 * time.Second)
+// Worker that checks codes until the channel is closed
+func worker(ctx context.Context, c *checker.Checker, codes <-chan string, results chan<- result, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for code := range codes {
+		// The error is kept in res.Err
+		res, _ := c.Check(ctx, code)
+		results <- result{Result: res}
+	}
+}
+
+// Log an event while checking a single code
+func logEvent(ev checker.Event) {
+	switch ev.Type {
+	case "request":
+		logRequest(ev)
+	case "ratelimited":
+		logWarn(" [!] Ratelimited, retrying in " + ev.Wait.String())
+	case "blocked":
+		logWarn(" [!] Blocked by a captcha or challenge page, retrying in " + ev.Wait.String())
+	case "wlidremoved":
+		logWarn(" [!] Removed an invalid WLID, " + strconv.Itoa(ev.Left) + " left")
+	case "proxyremoved":
+		logWarn(" [!] Removed proxy " + ev.Proxy + ", " + strconv.Itoa(ev.Left) + " left")
+	case "throttle":
+		logThrottle(ev.Wait)
+	}
 }
 
-// Change console title
-func setTitle(title string) {
-	cmd := exec.Command("cmd", "/C", "title", title)
-	cmd.Stdout = os.Stdout
-	cmd.Run()
-}
\ No newline at end of file
+// Log a change of the auto throttle delay
+func logThrottle(wait time.Duration) {
+	if wait == 0 {
+		logInfo(cyan, " [*] No longer ratelimited, stopped throttling requests")
+		return
+	}
+	logWarn(" [!] Ratelimited often, waiting " + wait.String() + " before each request")
+}
+
+// Log the details of a request for debugging
+func logRequest(ev checker.Event) {
+	if !logs.verbose {
+		return
+	}
+	msg := " [>] GET " + ev.URL + " | WLID " + checker.MaskWLID(ev.WLID) + " | " + ev.Status
+	if ev.HTTPStatus != 0 {
+		msg += " | HTTP " + strconv.Itoa(ev.HTTPStatus)
+	}
+	if ev.Err != nil {
+		msg += " | " + ev.Err.Error()
+	}
+	if ev.Body != "" {
+		msg += " | " + strings.Join(strings.Fields(ev.Body), " ")
+	}
+	logDebug(msg)
+}
+
+// Check the code from -check-one, or only show what would be checked with -dry-run, false on failure
+func runCheckOne(cfg Config, settings checker.Config) bool {
+	code := checker.NormalizeCode(cfg.CheckOne)
+	if cfg.DryRun {
+		logInfo(cyan, " [*] Dry run, no requests were sent")
+		logInfo(cyan, " [*] WLIDs: "+strconv.Itoa(len(settings.WLIDs))+" | Proxies: "+strconv.Itoa(len(settings.Proxies))+" | User agents: "+strconv.Itoa(len(settings.UserAgents)))
+		if !checker.IsValidCodeFormat(code) {
+			logWarn(" [!] " + code + " is malformed and would be invalid")
+			return true
+		}
+		logInfo(cyan, " [*] Would check "+code+" in "+strings.Join(settings.Markets, ", "))
+		return true
+	}
+	return checkOne(checker.New(settings), code)
+}
+
+// Check one code and print its full result, false if it couldn't be checked
+func checkOne(c *checker.Checker, code string) bool {
+	logInfo(cyan, " [*] Checking "+code+"...")
+	res, err := c.Check(context.Background(), code)
+	if err == checker.ErrNoWLIDs {
+		logError(" [-] Error: Every WLID is invalid, get a new one from redeem.microsoft.com")
+		return false
+	} else if err != nil {
+		logError(" [-] " + code + " couldn't be checked: " + errorReason(err))
+		return false
+	}
+	switch res.Status {
+	case "valid":
+		logInfo(green, " [+] "+code+" is valid"+describe(res)+" in "+res.Market+"!")
+	case "unknown":
+		logInfo(yellow, " [?] "+code+" is unknown: "+res.Body)
+	default:
+		logInfo(red, " [-] "+code+" is "+res.Status+"!")
+	}
+	return true
+}
+
+// Save a code, printing the full code if it can't be written so it isn't lost
+func saveResult(out *resultWriter, res result) {
+	if err := out.Write(res); err != nil {
+		logError(" [!] Failed to save "+res.Status+" code "+res.Code+":", err)
+	}
+}
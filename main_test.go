@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"XboxChecker/checker"
+)
+
+func TestRunCheckOneDryRun(t *testing.T) {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"tokenState":"Active"}`))
+	}))
+	defer server.Close()
+
+	cfg := Config{CheckOne: "aaaaa-bbbbb-ccccc-ddddd-eeeee", DryRun: true}
+	settings := checker.Config{WLIDs: []string{`WLID1.0="test"`}, Markets: []string{"US"}, APIBase: server.URL + "/"}
+	if !runCheckOne(cfg, settings) {
+		t.Error("dry run failed")
+	}
+	if requests.Load() != 0 {
+		t.Errorf("dry run sent %d requests", requests.Load())
+	}
+
+	cfg.DryRun = false
+	if !runCheckOne(cfg, settings) || requests.Load() != 1 {
+		t.Errorf("check sent %d requests, want 1", requests.Load())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Whether the menu should be shown, when started without flags from a terminal like after double clicking the exe
+func showMenu() bool {
+	return len(os.Args) == 1 && term.IsTerminal(int(os.Stdin.Fd())) && stdoutTerminal
+}
+
+// Ask for the common settings, an empty answer keeps the current value
+func runMenu(cfg *Config, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	ask := func(question string) (string, error) {
+		fmt.Fprint(out, question)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return strings.TrimSpace(scanner.Text()), nil
+	}
+	fmt.Fprintln(out, cyan(" Settings, press enter to keep the value in brackets. Run with -h to see every setting"))
+
+	answer, err := ask(" Market, or a comma separated list [" + cfg.Market + "]: ")
+	if err != nil {
+		return err
+	}
+	if markets := splitList(answer); len(markets) > 0 {
+		cfg.Market = strings.ToUpper(strings.Join(markets, ","))
+	}
+
+	for {
+		answer, err := ask(" Workers [" + strconv.Itoa(cfg.Workers) + "]: ")
+		if err != nil {
+			return err
+		}
+		if answer == "" {
+			break
+		}
+		if workers, err := strconv.Atoi(answer); err == nil && workers > 0 {
+			cfg.Workers = workers
+			break
+		}
+		fmt.Fprintln(out, yellow(" [!] Enter a number above 0"))
+	}
+
+	current := "y/N"
+	if cfg.Webhook != "" {
+		current = "Y/n"
+	}
+	answer, err = ask(" Send valid codes to a Discord webhook? [" + current + "]: ")
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		for {
+			prompt := " Webhook URL: "
+			if cfg.Webhook != "" {
+				prompt = " Webhook URL [" + cfg.Webhook + "]: "
+			}
+			url, err := ask(prompt)
+			if err != nil {
+				return err
+			}
+			if url == "" && cfg.Webhook != "" {
+				break
+			}
+			if strings.HasPrefix(url, "https://") {
+				cfg.Webhook = url
+				break
+			}
+			fmt.Fprintln(out, yellow(" [!] Enter the https:// URL of the webhook"))
+		}
+	case "n", "no":
+		cfg.Webhook = ""
+	}
+	fmt.Fprintln(out)
+	return nil
+}
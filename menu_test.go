@@ -0,0 +1,32 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRunMenu(t *testing.T) {
+	cfg := defaultConfig()
+	in := strings.NewReader("us, gb\nlots\n25\ny\nnot a url\nhttps://discord.com/api/webhooks/1/abc\n")
+	if err := runMenu(&cfg, in, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Market != "US,GB" || cfg.Workers != 25 || cfg.Webhook != "https://discord.com/api/webhooks/1/abc" {
+		t.Errorf("market = %q, workers = %d, webhook = %q", cfg.Market, cfg.Workers, cfg.Webhook)
+	}
+
+	// Empty answers keep the current settings
+	defaults := defaultConfig()
+	cfg = defaultConfig()
+	if err := runMenu(&cfg, strings.NewReader("\n\n\n"), io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Market != defaults.Market || cfg.Workers != defaults.Workers || cfg.Webhook != "" {
+		t.Errorf("config changed to %+v", cfg)
+	}
+
+	if err := runMenu(&cfg, strings.NewReader(""), io.Discard); err != io.EOF {
+		t.Errorf("err = %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Progress of a run as served on / by -metrics-addr
+type metricsStatus struct {
+	StatsSnapshot
+	State    string   `json:"state"` // running or finished
+	Checked  int      `json:"checked"`
+	Total    int      `json:"total"` // 0 when it isn't known, like with -watch or stdin
+	Rate     float64  `json:"rate"`  // codes per second
+	Duration duration `json:"duration"`
+}
+
+// Current progress of the run
+func newMetricsStatus(stats *Stats, total int) metricsStatus {
+	snap := stats.Snapshot()
+	status := metricsStatus{StatsSnapshot: snap, State: "running", Checked: snap.total(), Total: total}
+	if !snap.End.IsZero() {
+		status.State = "finished"
+	}
+	elapsed := snap.elapsed()
+	if elapsed > 0 {
+		status.Rate = float64(status.Checked) / elapsed.Seconds()
+	}
+	status.Duration = duration{elapsed.Round(time.Millisecond)}
+	return status
+}
+
+// JSON progress on /, Prometheus metrics on /metrics and a health check on /health
+func metricsHandler(stats *Stats, total int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(newMetricsStatus(stats, total))
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		status := newMetricsStatus(stats, total)
+		var b strings.Builder
+		b.WriteString("# HELP xcc_codes_checked_total Codes checked so far by status.\n# TYPE xcc_codes_checked_total counter\n")
+		for _, count := range []struct {
+			status string
+			n      int
+		}{{"valid", status.Valid}, {"used", status.Used}, {"pending", status.Pending}, {"expired", status.Expired}, {"invalid", status.Invalid}, {"unknown", status.Unknown}, {"error", status.Errors}} {
+			fmt.Fprintf(&b, "xcc_codes_checked_total{status=%q} %d\n", count.status, count.n)
+		}
+		fmt.Fprintf(&b, "# HELP xcc_codes Codes to check in this run, 0 when it isn't known.\n# TYPE xcc_codes gauge\nxcc_codes %d\n", status.Total)
+		fmt.Fprintf(&b, "# HELP xcc_codes_per_second Codes checked per second since the run started.\n# TYPE xcc_codes_per_second gauge\nxcc_codes_per_second %g\n", status.Rate)
+		fmt.Fprintf(&b, "# HELP xcc_elapsed_seconds Time since the run started.\n# TYPE xcc_elapsed_seconds gauge\nxcc_elapsed_seconds %g\n", status.Duration.Seconds())
+		finished := 0
+		if status.State == "finished" {
+			finished = 1
+		}
+		fmt.Fprintf(&b, "# HELP xcc_finished Whether the run is over.\n# TYPE xcc_finished gauge\nxcc_finished %d\n", finished)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write([]byte(b.String()))
+	})
+	return mux
+}
+
+// Serve the metrics of the run on a listener until the program exits
+func serveMetrics(ln net.Listener, stats *Stats, total int) {
+	server := &http.Server{Handler: metricsHandler(stats, total), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logError(" [!] Metrics server stopped:", err)
+		}
+	}()
+}
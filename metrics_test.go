@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"XboxChecker/checker"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	stats := newStats()
+	stats.add(result{Result: checker.Result{Status: "valid"}})
+	stats.add(result{Result: checker.Result{Status: "invalid"}})
+	stats.add(result{Result: checker.Result{Status: "invalid"}})
+	server := httptest.NewServer(metricsHandler(stats, 10))
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status metricsStatus
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.State != "running" || status.Checked != 3 || status.Total != 10 || status.Valid != 1 || status.Invalid != 2 {
+		t.Errorf("status = %+v", status)
+	}
+
+	resp, err = server.Client().Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{`xcc_codes_checked_total{status="invalid"} 2`, "xcc_codes 10", "xcc_finished 0"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
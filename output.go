@@ -0,0 +1,434 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"XboxChecker/checker"
+)
+
+// Output formats for -format
+const (
+	formatText = "text"
+	formatJSON = "json"
+	formatBoth = "both"
+)
+
+// Text file each status is saved to
+var textFiles = map[string]string{
+	"valid":    "working.txt",
+	"gamepass": "gamepass.txt",
+	"used":     "used.txt",
+	"pending":  "pending.txt",
+	"expired":  "expired.txt",
+	"invalid":  "invalid.txt",
+	"unknown":  "unknown.txt",
+	"error":    "errors.txt",
+}
+
+// Writes checked codes to the output files, buffered until Flush or Close
+type resultWriter struct {
+	mu        sync.Mutex
+	outputs   []*outputFile // every buffered file, once each
+	csvFile   *os.File
+	text      map[string]*outputFile
+	jsonl     *outputFile
+	hits      *outputFile // valid codes with what they redeem for, where and when
+	csv       *csv.Writer
+	mask      bool
+	market    bool          // add the market to text lines
+	maxSize   int64         // bytes each file can grow to before moving on to a numbered one, 0 for no limit
+	sorted    []*outputFile // text files to sort on Close
+	retried   int64         // bytes at the start of the errors file that were checked again, dropped on Close
+	noInvalid bool
+}
+
+// Line written to results.jsonl
+type jsonResult struct {
+	Code         string `json:"code"`
+	Status       string `json:"status"`
+	CheckedAt    string `json:"checkedAt"`
+	Market       string `json:"market"`
+	Description  string `json:"description,omitempty"`
+	Subscription bool   `json:"subscription,omitempty"`
+	Price        string `json:"price,omitempty"`
+}
+
+// Check that format is one of the output formats
+func checkFormat(format string) error {
+	if format != formatText && format != formatJSON && format != formatBoth {
+		return errors.New("invalid format " + format + ", expected text, json or both")
+	}
+	return nil
+}
+
+// Where and how results are written
+type outputOptions struct {
+	dir            string
+	format         string
+	csvPath        string
+	mask           bool              // hide the end of every code
+	paths          map[string]string // text file paths overriding the ones in dir, by status
+	mergeValidUsed bool              // save used codes with the valid ones
+	sort           bool              // sort the text files on Close
+	market         bool              // add the market each code was checked in to the text files
+	maxSize        int64             // rotate files once they reach this many bytes, 0 never rotates
+	noInvalid      bool              // don't save invalid codes anywhere
+}
+
+// Path of the text file for a status
+func (o outputOptions) textPath(status string) string {
+	if o.mergeValidUsed && status == "used" {
+		status = "valid"
+	}
+	if path := o.paths[status]; path != "" {
+		return path
+	}
+	return filepath.Join(o.dir, textFiles[status])
+}
+
+// Codes already saved by a previous run, from the text files or results.jsonl for -format json.
+// Every status except errors counts as checked, numbered files from -rotate-size are read too.
+func (o outputOptions) checkedCodes() (map[string]struct{}, error) {
+	checked := map[string]struct{}{}
+	if o.format != formatJSON {
+		read := map[string]bool{}
+		for status := range textFiles {
+			if status == "error" || read[o.textPath(status)] {
+				continue
+			}
+			path := o.textPath(status)
+			read[path] = true
+			err := eachPartLine(path, func(line string) {
+				if fields := strings.Fields(line); len(fields) > 0 {
+					checked[fields[0]] = struct{}{}
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if o.format != formatText {
+		err := eachPartLine(filepath.Join(o.dir, "results.jsonl"), func(line string) {
+			// Skipping lines cut off by a crash
+			var res jsonResult
+			if json.Unmarshal([]byte(line), &res) == nil && res.Code != "" && res.Status != "error" {
+				checked[res.Code] = struct{}{}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return checked, nil
+}
+
+// Call fn with every line of an output file and the numbered files it was rotated to
+func eachPartLine(path string, fn func(line string)) error {
+	part := &outputFile{path: path}
+	for n := 0; ; n++ {
+		err := eachLine(part.numbered(n), func(line string) bool {
+			fn(line)
+			return true
+		})
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// Open every output file once for the whole run, creating the output directory if needed
+func newResultWriter(opts outputOptions) (*resultWriter, error) {
+	if err := checkFormat(opts.format); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &resultWriter{text: map[string]*outputFile{}, mask: opts.mask, market: opts.market, maxSize: opts.maxSize, noInvalid: opts.noInvalid}
+	var err error
+	if opts.format != formatJSON {
+		// Statuses saved to the same path share one file
+		opened := map[string]*outputFile{}
+		for status := range textFiles {
+			if opts.noInvalid && status == "invalid" {
+				continue
+			}
+			path := opts.textPath(status)
+			b, ok := opened[path]
+			if !ok {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					w.Close()
+					return nil, err
+				}
+				if b, err = w.open(path); err != nil {
+					w.Close()
+					return nil, err
+				}
+				opened[path] = b
+				if opts.sort {
+					w.sorted = append(w.sorted, b)
+				}
+			}
+			w.text[status] = b
+		}
+		if w.hits, err = w.open(filepath.Join(opts.dir, "hits.txt")); err != nil {
+			w.Close()
+			return nil, err
+		}
+		if opts.sort {
+			w.sorted = append(w.sorted, w.hits)
+		}
+	}
+	if opts.format != formatText {
+		if w.jsonl, err = w.open(filepath.Join(opts.dir, "results.jsonl")); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	if opts.csvPath != "" {
+		if err := w.openCSV(opts.csvPath); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Open the CSV file, writing the header row if the file is new
+func (w *resultWriter) openCSV(path string) error {
+	f, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	w.csvFile = f
+	w.csv = csv.NewWriter(f)
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		w.csv.Write([]string{"code", "status", "httpStatus", "tokenState", "timestamp"})
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// Open a buffered output file for appending
+func (w *resultWriter) open(path string) (*outputFile, error) {
+	o, err := openOutputFile(path, w.maxSize)
+	if err != nil {
+		return nil, err
+	}
+	w.outputs = append(w.outputs, o)
+	return o, nil
+}
+
+// Open a file for appending
+func openOutput(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+}
+
+// Append a result to the files for its status
+func (w *resultWriter) Write(res result) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := res.Status
+	if res.Err != nil {
+		status = "error"
+	}
+	if w.noInvalid && status == "invalid" {
+		return nil
+	}
+	code := res.Code
+	if w.mask {
+		code = checker.MaskCode(code)
+	}
+
+	checkedAt := time.Now().Format(time.RFC3339)
+
+	// Valid Game Pass and other subscription codes get their own text file
+	textStatus := status
+	if status == "valid" && res.Subscription {
+		textStatus = "gamepass"
+	}
+	if b, ok := w.text[textStatus]; ok {
+		line := code
+		if w.market && res.Market != "" && status != "error" {
+			line += " | " + res.Market
+		}
+		if textStatus == "gamepass" && res.Description != "" {
+			line += " | " + res.Description
+		}
+		if status == "unknown" {
+			// Keeping the response so new token states can be looked into
+			line += " | " + strings.Join(strings.Fields(res.Body), " ")
+		} else if status == "error" && res.Err != nil {
+			// The reason is a comment so the file can be used as input again
+			line += " # " + errorReason(res.Err)
+		}
+		if err := b.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+
+	if w.hits != nil && status == "valid" {
+		product := res.Description
+		if product == "" {
+			product = "-"
+		}
+		if res.Price != "" {
+			product += " (" + res.Price + ")"
+		}
+		if err := w.hits.WriteString(code + " | " + product + " | " + res.Market + " | " + checkedAt + "\n"); err != nil {
+			return err
+		}
+	}
+
+	if w.jsonl != nil {
+		line, err := json.Marshal(jsonResult{
+			Code:         code,
+			Status:       status,
+			CheckedAt:    checkedAt,
+			Market:       res.Market,
+			Description:  res.Description,
+			Subscription: res.Subscription,
+			Price:        res.Price,
+		})
+		if err != nil {
+			return err
+		}
+		if err := w.jsonl.WriteString(string(line) + "\n"); err != nil {
+			return err
+		}
+	}
+
+	if w.csv != nil {
+		httpStatus := ""
+		if res.HTTPStatus != 0 {
+			httpStatus = strconv.Itoa(res.HTTPStatus)
+		}
+		if err := w.csv.Write([]string{code, status, httpStatus, res.TokenState, checkedAt}); err != nil {
+			return err
+		}
+	}
+
+	// Valid codes are written out straight away so a crash can't lose them
+	if status == "valid" {
+		return w.flush()
+	}
+	return nil
+}
+
+// Write everything buffered to the output files
+func (w *resultWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *resultWriter) flush() error {
+	var firstErr error
+	for _, o := range w.outputs {
+		if err := o.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Flush and close every output file
+func (w *resultWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	firstErr := w.flush()
+	for _, o := range w.outputs {
+		if err := o.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if w.csvFile != nil {
+		if err := w.csvFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if b := w.text["error"]; b != nil && w.retried > 0 {
+		if err := dropStart(b.path, w.retried); err != nil {
+			return err
+		}
+	}
+	for _, o := range w.sorted {
+		for _, path := range o.parts {
+			if err := sortFile(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Drop the errors an earlier run left in the errors file once they were all checked again by -retry-file,
+// size is how big the file was when the run started
+func (w *resultWriter) DropRetried(size int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.retried = size
+}
+
+// Remove the first n bytes of a file, rewriting it in place
+func dropStart(path string, n int64) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if n > int64(len(content)) {
+		n = int64(len(content))
+	}
+	return os.WriteFile(path, content[n:], 0600)
+}
+
+// Sort the lines of a file alphabetically, rewriting it in place
+func sortFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+	sort.Strings(lines)
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
+
+// Single line reason for an error, short enough to read in a text file
+func errorReason(err error) string {
+	reason := strings.Join(strings.Fields(err.Error()), " ")
+	if len(reason) > 200 {
+		reason = reason[:200] + "..."
+	}
+	return reason
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"XboxChecker/checker"
+)
+
+func TestResultWriter(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newResultWriter(outputOptions{dir: dir, format: formatText, mergeValidUsed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA", Status: "valid"}})
+	w.Write(result{Result: checker.Result{Code: "BBBBB-BBBBB-BBBBB-BBBBB-BBBBB", Status: "used"}})
+	w.Write(result{Result: checker.Result{Code: "CCCCC-CCCCC-CCCCC-CCCCC-CCCCC", Status: "invalid", Err: errors.New("timeout")}})
+
+	// Valid codes are flushed straight away, the rest wait for Close
+	content, _ := os.ReadFile(filepath.Join(dir, "working.txt"))
+	if string(content) != "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA\n" {
+		t.Errorf("working.txt before close = %q", content)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ = os.ReadFile(filepath.Join(dir, "working.txt"))
+	if string(content) != "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA\nBBBBB-BBBBB-BBBBB-BBBBB-BBBBB\n" {
+		t.Errorf("working.txt = %q", content)
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, "errors.txt"))
+	if string(content) != "CCCCC-CCCCC-CCCCC-CCCCC-CCCCC # timeout\n" {
+		t.Errorf("errors.txt = %q", content)
+	}
+}
+
+func TestResultWriterMarket(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newResultWriter(outputOptions{dir: dir, format: formatText, market: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA", Market: "GB", Status: "valid"}})
+	w.Write(result{Result: checker.Result{Code: "BBBBB-BBBBB-BBBBB-BBBBB-BBBBB", Market: "US", Status: "unknown", Body: `{"tokenState":"Pending"}`}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "working.txt"))
+	if string(content) != "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA | GB\n" {
+		t.Errorf("working.txt = %q", content)
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, "unknown.txt"))
+	if string(content) != "BBBBB-BBBBB-BBBBB-BBBBB-BBBBB | US | {\"tokenState\":\"Pending\"}\n" {
+		t.Errorf("unknown.txt = %q", content)
+	}
+}
+
+func TestResultWriterNoInvalid(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newResultWriter(outputOptions{dir: dir, format: formatBoth, noInvalid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA", Status: "invalid"}})
+	w.Write(result{Result: checker.Result{Code: "BBBBB-BBBBB-BBBBB-BBBBB-BBBBB", Status: "used"}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "invalid.txt")); !os.IsNotExist(err) {
+		t.Errorf("invalid.txt was created")
+	}
+	content, _ := os.ReadFile(filepath.Join(dir, "results.jsonl"))
+	if strings.Contains(string(content), "AAAAA") || !strings.Contains(string(content), "BBBBB") {
+		t.Errorf("results.jsonl = %q", content)
+	}
+}
+
+func TestResultWriterSort(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "invalid.txt")
+	if err := os.WriteFile(path, []byte("CCCCC-CCCCC-CCCCC-CCCCC-CCCCC\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, err := newResultWriter(outputOptions{dir: dir, format: formatText, sort: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(result{Result: checker.Result{Code: "DDDDD-DDDDD-DDDDD-DDDDD-DDDDD", Status: "invalid"}})
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA", Status: "invalid"}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA\nCCCCC-CCCCC-CCCCC-CCCCC-CCCCC\nDDDDD-DDDDD-DDDDD-DDDDD-DDDDD\n" {
+		t.Errorf("invalid.txt = %q", content)
+	}
+	if content, _ := os.ReadFile(filepath.Join(dir, "working.txt")); len(content) != 0 {
+		t.Errorf("working.txt = %q, want it empty", content)
+	}
+}
+
+func TestResultWriterHits(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newResultWriter(outputOptions{dir: dir, format: formatText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA", Market: "GB", Status: "valid", Description: "Xbox Game Pass Ultimate", Subscription: true}})
+	w.Write(result{Result: checker.Result{Code: "BBBBB-BBBBB-BBBBB-BBBBB-BBBBB", Market: "US", Status: "used"}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "hits.txt"))
+	fields := strings.Split(strings.TrimSpace(string(content)), " | ")
+	if len(fields) != 4 || fields[0] != "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA" || fields[1] != "Xbox Game Pass Ultimate" || fields[2] != "GB" {
+		t.Fatalf("hits.txt = %q", content)
+	}
+	if _, err := time.Parse(time.RFC3339, fields[3]); err != nil {
+		t.Errorf("timestamp: %v", err)
+	}
+}
+
+func TestResultWriterRotate(t *testing.T) {
+	dir := t.TempDir()
+	// Room for two codes per file
+	w, err := newResultWriter(outputOptions{dir: dir, format: formatText, maxSize: 60})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"AAAAA-AAAAA-AAAAA-AAAAA-AAAA1", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA2", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA3"} {
+		w.Write(result{Result: checker.Result{Code: code, Status: "invalid"}})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "invalid.txt"))
+	if string(content) != "AAAAA-AAAAA-AAAAA-AAAAA-AAAA1\nAAAAA-AAAAA-AAAAA-AAAAA-AAAA2\n" {
+		t.Errorf("invalid.txt = %q", content)
+	}
+	content, _ = os.ReadFile(filepath.Join(dir, "invalid.1.txt"))
+	if string(content) != "AAAAA-AAAAA-AAAAA-AAAAA-AAAA3\n" {
+		t.Errorf("invalid.1.txt = %q", content)
+	}
+}
+
+func TestCheckedCodes(t *testing.T) {
+	dir := t.TempDir()
+	opts := outputOptions{dir: dir, format: formatText, market: true, maxSize: 60}
+	w, err := newResultWriter(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAA1", Status: "valid", Market: "US"}})
+	for _, code := range []string{"AAAAA-AAAAA-AAAAA-AAAAA-AAAA2", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA3", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA4"} {
+		w.Write(result{Result: checker.Result{Code: code, Status: "invalid"}})
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAA5", Err: errors.New("timeout")}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checked, err := opts.checkedCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"AAAAA-AAAAA-AAAAA-AAAAA-AAAA1", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA2", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA4"} {
+		if _, ok := checked[code]; !ok {
+			t.Errorf("%s not in the checked codes", code)
+		}
+	}
+	if _, ok := checked["AAAAA-AAAAA-AAAAA-AAAAA-AAAA5"]; ok {
+		t.Error("errored code counted as checked")
+	}
+	if len(checked) != 4 {
+		t.Errorf("got %d checked codes, want 4", len(checked))
+	}
+}
+
+func TestCheckedCodesJSON(t *testing.T) {
+	dir := t.TempDir()
+	opts := outputOptions{dir: dir, format: formatJSON, maxSize: 150}
+	w, err := newResultWriter(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{"AAAAA-AAAAA-AAAAA-AAAAA-AAAA1", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA2", "AAAAA-AAAAA-AAAAA-AAAAA-AAAA3"} {
+		w.Write(result{Result: checker.Result{Code: code, Status: "invalid"}})
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAA4", Err: errors.New("timeout")}})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checked, err := opts.checkedCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checked) != 3 {
+		t.Errorf("got %d checked codes, want 3", len(checked))
+	}
+	if _, ok := checked["AAAAA-AAAAA-AAAAA-AAAAA-AAAA3"]; !ok {
+		t.Error("code in a rotated results file not counted as checked")
+	}
+	if _, ok := checked["AAAAA-AAAAA-AAAAA-AAAAA-AAAA4"]; ok {
+		t.Error("errored code counted as checked")
+	}
+}
+
+func TestResultWriterDropRetried(t *testing.T) {
+	dir := t.TempDir()
+	old := "AAAAA-AAAAA-AAAAA-AAAAA-AAAA1 # timeout\n"
+	os.WriteFile(filepath.Join(dir, "errors.txt"), []byte(old), 0600)
+	w, err := newResultWriter(outputOptions{dir: dir, format: formatText})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAA2", Err: errors.New("timeout")}})
+	w.DropRetried(int64(len(old)))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(filepath.Join(dir, "errors.txt"))
+	if string(content) != "AAAAA-AAAAA-AAAAA-AAAAA-AAAA2 # timeout\n" {
+		t.Errorf("errors.txt = %q", content)
+	}
+}
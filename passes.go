@@ -0,0 +1,51 @@
+package main
+
+import "sync"
+
+// Codes that errored in a pass, checked again in the next one until they resolve or the passes run out
+type retryPasses struct {
+	mu      sync.Mutex
+	pending sync.WaitGroup // codes sent in the current pass that haven't been handled yet
+	pass    int            // current pass, 0 is the first
+	max     int            // extra passes after the first
+	errored []string
+}
+
+// Passes that retry errored codes up to max more times
+func newRetryPasses(max int) *retryPasses {
+	return &retryPasses{max: max}
+}
+
+// Count a code sent to the workers in the current pass
+func (p *retryPasses) sent() {
+	p.pending.Add(1)
+}
+
+// Count a result of the current pass as handled
+func (p *retryPasses) handled() {
+	p.pending.Done()
+}
+
+// Keep an errored code for the next pass, false when there are no passes left
+func (p *retryPasses) retry(code string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pass >= p.max {
+		return false
+	}
+	p.errored = append(p.errored, code)
+	return true
+}
+
+// Wait for every code of the current pass, then start the next one with the codes that errored
+func (p *retryPasses) next() (pass int, codes []string) {
+	p.pending.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	codes = p.errored
+	p.errored = nil
+	if len(codes) > 0 {
+		p.pass++
+	}
+	return p.pass, codes
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestRetryPasses(t *testing.T) {
+	p := newRetryPasses(1)
+	p.sent()
+	p.sent()
+	if !p.retry("A") {
+		t.Fatal("retry in the first pass = false")
+	}
+	p.handled()
+	p.handled()
+
+	pass, codes := p.next()
+	if pass != 1 || len(codes) != 1 || codes[0] != "A" {
+		t.Fatalf("next = %d, %q", pass, codes)
+	}
+	p.sent()
+	if p.retry("A") {
+		t.Error("retry in the last pass = true")
+	}
+	p.handled()
+	if _, codes := p.next(); len(codes) != 0 {
+		t.Errorf("codes after the last pass = %q", codes)
+	}
+}
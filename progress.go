@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Records checked codes so an interrupted run can resume where it left off
+type progress struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File
+	w       *bufio.Writer
+	pending []string // checked codes that may still be waiting in the output buffers
+}
+
+// Progress file used for a codes file, directories and globs share one in their directory and stdin and the clipboard have none
+func progressPath(codesPath string) string {
+	if codesPath == stdinPath || codesPath == clipboardPath {
+		return ""
+	}
+	if isGlob(codesPath) {
+		return filepath.Join(filepath.Dir(codesPath), "codes.progress")
+	}
+	if info, err := os.Stat(codesPath); err == nil && info.IsDir() {
+		return filepath.Join(codesPath, "codes.progress")
+	}
+	return codesPath + ".progress"
+}
+
+// Load the codes checked by a previous run, a missing file means nothing was checked
+func loadProgress(path string) (map[string]struct{}, error) {
+	if path == "" {
+		return map[string]struct{}{}, nil
+	}
+	lines, err := readLines(path)
+	if os.IsNotExist(err) {
+		return map[string]struct{}{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	checked := make(map[string]struct{}, len(lines))
+	for _, line := range lines {
+		checked[line] = struct{}{}
+	}
+	return checked, nil
+}
+
+// Open the progress file for appending, an empty path records nothing
+func openProgress(path string) (*progress, error) {
+	if path == "" {
+		return &progress{}, nil
+	}
+	f, err := openOutput(path)
+	if err != nil {
+		return nil, err
+	}
+	return &progress{path: path, f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// Mark a code as checked once its result was handed to the output files,
+// it is only saved by a later Flush so it can't get ahead of the output
+func (p *progress) done(code string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	p.pending = append(p.pending, code)
+	return nil
+}
+
+// Take the codes marked so far, to Flush once the output they were written to has been flushed
+func (p *progress) take() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	codes := p.pending
+	p.pending = nil
+	return codes
+}
+
+// Return codes from take when their output couldn't be flushed, so Close still saves them
+func (p *progress) putBack(codes []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(codes, p.pending...)
+}
+
+// Write codes from take to the progress file
+func (p *progress) Flush(codes []string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	for _, code := range codes {
+		if _, err := p.w.WriteString(code + "\n"); err != nil {
+			return err
+		}
+	}
+	return p.w.Flush()
+}
+
+// Close the progress file with every marked code, keeping it so the next run can resume.
+// The output files have to be closed first.
+func (p *progress) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.f == nil {
+		return nil
+	}
+	for _, code := range p.pending {
+		if _, err := p.w.WriteString(code + "\n"); err != nil {
+			p.f.Close()
+			return err
+		}
+	}
+	p.pending = nil
+	if err := p.w.Flush(); err != nil {
+		p.f.Close()
+		return err
+	}
+	return p.f.Close()
+}
+
+// Close and remove the progress file once every code has been checked
+func (p *progress) finish() error {
+	if err := p.Close(); err != nil || p.path == "" {
+		return err
+	}
+	return os.Remove(p.path)
+}
+
+// Write the codes that weren't checked to path, replacing it, and return how many there were
+func saveRemaining(path string, codes []string, checked map[string]struct{}) (int, error) {
+	var b strings.Builder
+	left := 0
+	for _, code := range codes {
+		if _, ok := checked[code]; ok {
+			continue
+		}
+		b.WriteString(code + "\n")
+		left++
+	}
+	if left == 0 {
+		return 0, nil
+	}
+	return left, os.WriteFile(path, []byte(b.String()), 0600)
+}
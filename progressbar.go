@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Width of the bar itself in characters
+const barWidth = 30
+
+// Progress bar drawn on the last line of the console
+type progressBar struct {
+	mu      sync.Mutex
+	enabled bool
+	total   int
+	checked int
+	start   time.Time
+}
+
+// Shared bar, lines logged while it is drawn are kept above it
+var bar = &progressBar{}
+
+// Start drawing the bar for total codes
+func (p *progressBar) begin(total int, enabled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enabled = enabled
+	p.total = total
+	p.checked = 0
+	p.start = time.Now()
+	p.draw()
+}
+
+// Update the amount of checked codes
+func (p *progressBar) update(checked int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checked = checked
+	p.draw()
+}
+
+// Stop drawing the bar, leaving the last state on screen
+func (p *progressBar) end() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.enabled {
+		p.draw()
+		fmt.Println()
+		p.enabled = false
+	}
+}
+
+// Print a line above the bar
+func (p *progressBar) println(a ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.enabled {
+		fmt.Print("\r\033[K")
+	}
+	fmt.Println(a...)
+	p.draw()
+}
+
+// Draw the bar over the current line, the lock must be held
+func (p *progressBar) draw() {
+	if !p.enabled {
+		return
+	}
+	rate := 0.0
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = float64(p.checked) / elapsed
+	}
+
+	// Codes streamed from stdin aren't counted first, so there is nothing to fill the bar against
+	if p.total <= 0 {
+		fmt.Print("\r\033[K" + cyan(fmt.Sprintf(" [*] %d codes checked | %.2f codes/s", p.checked, rate)))
+		return
+	}
+
+	percent := p.checked * 100 / p.total
+	if percent > 100 {
+		percent = 100
+	}
+	filled := barWidth * percent / 100
+	eta := "--"
+	if rate > 0 && p.checked <= p.total {
+		eta = (time.Duration(float64(p.total-p.checked)/rate) * time.Second).Round(time.Second).String()
+	}
+
+	fmt.Print("\r\033[K" + cyan(fmt.Sprintf(" [%s%s] %d/%d %d%% | %.2f codes/s | ETA %s",
+		strings.Repeat("█", filled), strings.Repeat("░", barWidth-filled), p.checked, p.total, percent, rate, eta)))
+}
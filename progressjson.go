@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"XboxChecker/checker"
+)
+
+// Writes one JSON object per line for -progress-json, so frontends can follow a run without parsing the console output
+type jsonStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// Shared stream, nil unless -progress-json is set
+var progressJSON *jsonStream
+
+func newJSONStream(w io.Writer) *jsonStream {
+	return &jsonStream{enc: json.NewEncoder(w)}
+}
+
+// Line written for every log message
+type logEventJSON struct {
+	Type    string `json:"type"` // log
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// Line written for every checked code
+type resultEventJSON struct {
+	Type        string `json:"type"` // result
+	Code        string `json:"code"`
+	Status      string `json:"status"`
+	Market      string `json:"market"`
+	Description string `json:"description,omitempty"`
+	Price       string `json:"price,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CheckedAt   string `json:"checkedAt"`
+}
+
+// Line written when the run starts, after every checked code and when the run is over
+type progressEventJSON struct {
+	Type    string `json:"type"` // progress, or finished for the last one
+	Checked int    `json:"checked"`
+	Total   int    `json:"total"` // 0 when it isn't known, like with -watch or stdin
+	StatsSnapshot
+}
+
+// Write one line, errors are ignored since there is nowhere left to report them
+func (s *jsonStream) emit(v interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enc.Encode(v)
+}
+
+// Write a log message
+func (s *jsonStream) log(level string, msg string) {
+	s.emit(logEventJSON{Type: "log", Level: level, Message: strings.TrimSpace(msg)})
+}
+
+// Write a checked code, masked like the output files with mask
+func (s *jsonStream) result(res result, mask bool) {
+	event := resultEventJSON{
+		Type:        "result",
+		Code:        res.Code,
+		Status:      res.Status,
+		Market:      res.Market,
+		Description: res.Description,
+		Price:       res.Price,
+		CheckedAt:   time.Now().Format(time.RFC3339),
+	}
+	if mask {
+		event.Code = checker.MaskCode(res.Code)
+	}
+	if res.Err != nil {
+		event.Status = "error"
+		event.Error = errorReason(res.Err)
+	}
+	s.emit(event)
+}
+
+// Write the progress of the run
+func (s *jsonStream) progress(checked int, total int, stats StatsSnapshot) {
+	event := progressEventJSON{Type: "progress", Checked: checked, Total: total, StatsSnapshot: stats}
+	if !stats.End.IsZero() {
+		event.Type = "finished"
+	}
+	s.emit(event)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"XboxChecker/checker"
+)
+
+func TestJSONStream(t *testing.T) {
+	var buf bytes.Buffer
+	s := newJSONStream(&buf)
+	s.progress(0, 2, StatsSnapshot{})
+	s.result(result{Result: checker.Result{Code: "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA", Status: "valid", Market: "US"}}, false)
+	s.result(result{Result: checker.Result{Code: "BBBBB-BBBBB-BBBBB-BBBBB-BBBBB", Status: "error", Err: errors.New("timeout")}}, true)
+	s.log(levelWarn, " [!] Ratelimited")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines:\n%s", len(lines), buf.String())
+	}
+	var events []map[string]interface{}
+	for _, line := range lines {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		events = append(events, event)
+	}
+	if events[0]["type"] != "progress" || events[0]["total"] != 2.0 {
+		t.Errorf("progress = %v", events[0])
+	}
+	if events[1]["type"] != "result" || events[1]["code"] != "AAAAA-AAAAA-AAAAA-AAAAA-AAAAA" || events[1]["status"] != "valid" {
+		t.Errorf("result = %v", events[1])
+	}
+	if events[2]["code"] != checker.MaskCode("BBBBB-BBBBB-BBBBB-BBBBB-BBBBB") || events[2]["error"] != "timeout" {
+		t.Errorf("error result = %v", events[2])
+	}
+	if events[3]["type"] != "log" || events[3]["level"] != levelWarn || events[3]["message"] != "[!] Ratelimited" {
+		t.Errorf("log = %v", events[3])
+	}
+}
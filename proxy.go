@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Load proxies from a file, a missing file means no proxies
+func loadProxies(path string) ([]*url.URL, error) {
+	lines, err := readLines(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var proxies []*url.URL
+	for _, line := range lines {
+		proxy, err := parseProxy(line)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, nil
+}
+
+// Parse host:port or user:pass@host:port, defaulting to http when no scheme is given
+func parseProxy(line string) (*url.URL, error) {
+	if !strings.Contains(line, "://") {
+		line = "http://" + line
+	}
+	proxy, err := url.Parse(line)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy %q: %v", line, err)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy %q: unsupported scheme %s", line, proxy.Scheme)
+	}
+	if proxy.Host == "" || proxy.Port() == "" {
+		return nil, fmt.Errorf("invalid proxy %q: expected host:port", line)
+	}
+	return proxy, nil
+}
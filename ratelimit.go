@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// Ratelimit saved between runs so a restart doesn't hit it again straight away
+type ratelimitState struct {
+	Until time.Time `json:"until"`
+}
+
+// Load when the last ratelimit ends, a missing file means there is none
+func loadRatelimit(path string) (time.Time, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	var state ratelimitState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return time.Time{}, errors.New("invalid ratelimit state " + path + ": " + err.Error())
+	}
+	return state.Until, nil
+}
+
+// Save when the last ratelimit ends
+func saveRatelimit(path string, until time.Time) error {
+	content, err := json.Marshal(ratelimitState{Until: until})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0600)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRatelimitState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.json")
+	if until, err := loadRatelimit(path); err != nil || !until.IsZero() {
+		t.Fatalf("loadRatelimit of a missing file = %s, %v", until, err)
+	}
+	until := time.Now().Add(time.Minute).Truncate(time.Second)
+	if err := saveRatelimit(path, until); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := loadRatelimit(path); err != nil || !loaded.Equal(until) {
+		t.Errorf("loadRatelimit = %s, %v, want %s", loaded, err, until)
+	}
+}
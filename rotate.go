@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Buffered output file that moves on to a numbered file next to it, like working.1.txt, once it grows past max bytes
+type outputFile struct {
+	path  string // first file, the numbered ones share its name
+	max   int64  // 0 never rotates
+	n     int    // number of the file being written, 0 is path itself
+	f     *os.File
+	w     *bufio.Writer
+	size  int64
+	parts []string // every file written to by this run
+}
+
+// Open an output file for appending, carrying on in the last numbered file of an earlier run
+func openOutputFile(path string, max int64) (*outputFile, error) {
+	o := &outputFile{path: path, max: max}
+	if max > 0 {
+		for {
+			if _, err := os.Stat(o.numbered(o.n + 1)); err != nil {
+				break
+			}
+			o.n++
+		}
+	}
+	if err := o.openPart(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Path of the file with number n
+func (o *outputFile) numbered(n int) string {
+	if n == 0 {
+		return o.path
+	}
+	ext := filepath.Ext(o.path)
+	return strings.TrimSuffix(o.path, ext) + "." + strconv.Itoa(n) + ext
+}
+
+// Open the file being written
+func (o *outputFile) openPart() error {
+	path := o.numbered(o.n)
+	f, err := openOutput(path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	o.f, o.w, o.size = f, bufio.NewWriter(f), info.Size()
+	o.parts = append(o.parts, path)
+	return nil
+}
+
+// Write whole lines, moving on to the next file first if they would take this one past max
+func (o *outputFile) WriteString(lines string) error {
+	if o.max > 0 && o.size > 0 && o.size+int64(len(lines)) > o.max {
+		if err := o.Close(); err != nil {
+			return err
+		}
+		o.n++
+		if err := o.openPart(); err != nil {
+			return err
+		}
+	}
+	n, err := o.w.WriteString(lines)
+	o.size += int64(n)
+	return err
+}
+
+// Write the buffered lines to the file
+func (o *outputFile) Flush() error {
+	return o.w.Flush()
+}
+
+// Flush and close the file being written
+func (o *outputFile) Close() error {
+	if err := o.w.Flush(); err != nil {
+		o.f.Close()
+		return err
+	}
+	return o.f.Close()
+}
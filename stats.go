@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Counts of checked codes for a run, safe to update and read from any goroutine
+type Stats struct {
+	valid   atomic.Int64
+	used    atomic.Int64
+	pending atomic.Int64
+	expired atomic.Int64
+	invalid atomic.Int64
+	unknown atomic.Int64
+	errors  atomic.Int64
+	start   time.Time
+	end     atomic.Int64 // unix nanoseconds, 0 until the run is over
+}
+
+// Counts at one point in time
+type StatsSnapshot struct {
+	Valid   int       `json:"valid"`
+	Used    int       `json:"used"`
+	Pending int       `json:"pending"`
+	Expired int       `json:"expired"`
+	Invalid int       `json:"invalid"`
+	Unknown int       `json:"unknown"`
+	Errors  int       `json:"errors"`
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"` // zero until the run is over
+}
+
+// Stats for a run starting now
+func newStats() *Stats {
+	return &Stats{start: time.Now()}
+}
+
+// Count a finished result
+func (s *Stats) add(res result) {
+	if res.Err != nil {
+		s.errors.Add(1)
+		return
+	}
+	switch res.Status {
+	case "valid":
+		s.valid.Add(1)
+	case "used":
+		s.used.Add(1)
+	case "pending":
+		s.pending.Add(1)
+	case "expired":
+		s.expired.Add(1)
+	case "invalid":
+		s.invalid.Add(1)
+	case "unknown":
+		s.unknown.Add(1)
+	}
+}
+
+// Mark the run as over
+func (s *Stats) stop() {
+	s.end.Store(time.Now().UnixNano())
+}
+
+// Read the current counts without locking
+func (s *Stats) Snapshot() StatsSnapshot {
+	snap := StatsSnapshot{
+		Valid:   int(s.valid.Load()),
+		Used:    int(s.used.Load()),
+		Pending: int(s.pending.Load()),
+		Expired: int(s.expired.Load()),
+		Invalid: int(s.invalid.Load()),
+		Unknown: int(s.unknown.Load()),
+		Errors:  int(s.errors.Load()),
+		Start:   s.start,
+	}
+	if end := s.end.Load(); end != 0 {
+		snap.End = time.Unix(0, end)
+	}
+	return snap
+}
+
+// Total codes counted
+func (s StatsSnapshot) total() int {
+	return s.Valid + s.Used + s.Pending + s.Expired + s.Invalid + s.Unknown + s.Errors
+}
+
+// Time the run took, so far if it isn't over
+func (s StatsSnapshot) elapsed() time.Duration {
+	if s.End.IsZero() {
+		return time.Since(s.Start)
+	}
+	return s.End.Sub(s.Start)
+}
+
+// Human readable summary of the run
+func (s StatsSnapshot) summary() string {
+	elapsed := s.elapsed()
+	rate := 0.0
+	if elapsed > 0 {
+		rate = float64(s.total()) / elapsed.Seconds()
+	}
+	return fmt.Sprintf("Valid: %d | Used: %d | Pending: %d | Expired: %d | Invalid: %d | Unknown: %d | Errors: %d\n Elapsed: %s | %.2f codes/second",
+		s.Valid, s.Used, s.Pending, s.Expired, s.Invalid, s.Unknown, s.Errors, elapsed.Round(time.Second), rate)
+}
+
+// Save the stats as JSON for dashboards and scripts
+func (s StatsSnapshot) save(path string) error {
+	content, err := json.MarshalIndent(struct {
+		StatsSnapshot
+		Total    int      `json:"total"`
+		Duration duration `json:"duration"`
+	}{s, s.total(), duration{s.elapsed().Round(time.Millisecond)}}, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0600)
+}
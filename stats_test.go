@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"XboxChecker/checker"
+)
+
+func TestStatsSave(t *testing.T) {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	stats := &Stats{start: start}
+	stats.add(result{Result: checker.Result{Status: "valid"}})
+	stats.add(result{Result: checker.Result{Status: "invalid"}})
+	stats.add(result{Result: checker.Result{Status: "valid", Err: errors.New("timeout")}})
+	snap := stats.Snapshot()
+	snap.End = start.Add(90 * time.Second)
+
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := snap.save(path); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved map[string]interface{}
+	if err := json.Unmarshal(content, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved["total"] != 3.0 || saved["valid"] != 1.0 || saved["errors"] != 1.0 || saved["duration"] != "1m30s" || saved["start"] != "2023-01-01T12:00:00Z" {
+		t.Errorf("stats.json = %s", content)
+	}
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	stats := newStats()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				stats.add(result{Result: checker.Result{Status: "used"}})
+				stats.Snapshot()
+			}
+		}()
+	}
+	wg.Wait()
+	if snap := stats.Snapshot(); snap.Used != 8000 || snap.total() != 8000 {
+		t.Errorf("snapshot = %+v", snap)
+	}
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"os"
+
+	"XboxChecker/checker"
+)
+
+// Load the built in user agents plus any extras from a file, a missing file is ignored
+func loadUserAgents(path string) ([]string, error) {
+	userAgents := append([]string(nil), checker.DefaultUserAgents...)
+	extra, err := readLines(path)
+	if os.IsNotExist(err) {
+		return userAgents, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return append(userAgents, extra...), nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Build details, set with -ldflags "-X main.version=v1.2.0 -X main.commit=abc1234 -X main.buildDate=2022-10-01"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// Version string for -version and bug reports, filled in from the Go build info when ldflags weren't set
+func versionString() string {
+	rev, date, modified := commit, buildDate, false
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if rev == "" {
+					rev = setting.Value
+				}
+			case "vcs.time":
+				if date == "" {
+					date = setting.Value
+				}
+			case "vcs.modified":
+				modified = setting.Value == "true"
+			}
+		}
+	}
+	details := []string{runtime.Version(), runtime.GOOS + "/" + runtime.GOARCH}
+	if rev != "" {
+		if len(rev) > 12 {
+			rev = rev[:12]
+		}
+		if modified {
+			rev += "-dirty"
+		}
+		details = append([]string{"commit " + rev}, details...)
+	}
+	if date != "" {
+		details = append(details, "built "+date)
+	}
+	return "Xbox Code Checker " + version + " (" + strings.Join(details, ", ") + ")"
+}
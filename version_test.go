@@ -0,0 +1,17 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionString(t *testing.T) {
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+	version, commit = "v1.2.0", "0123456789abcdef"
+	got := versionString()
+	for _, want := range []string{"v1.2.0", "commit 0123456789ab", "/"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("versionString() = %q, want it to contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"XboxChecker/checker"
+)
+
+// Client used for webhooks, separate from the checking clients and proxies
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// Discord embed colors
+const (
+	embedGreen = 0x2ecc71
+	embedBlue  = 0x3498db
+)
+
+// Most hits sent in one message, so the embed stays under Discord's description limit
+const maxWebhookBatch = 25
+
+// Valid code waiting to be sent to the webhook
+type webhookHit struct {
+	code    string
+	product string
+}
+
+// Send a Discord embed for valid codes, with what they redeem for when known
+func notifyWebhook(webhookURL string, hits []webhookHit) error {
+	title := "Valid code found!"
+	if len(hits) > 1 {
+		title = strconv.Itoa(len(hits)) + " valid codes found!"
+	}
+	lines := make([]string, len(hits))
+	for i, hit := range hits {
+		line := "`" + checker.MaskCode(hit.code) + "`"
+		if hit.product != "" {
+			product := hit.product
+			if len(product) > 100 {
+				product = product[:100] + "..."
+			}
+			if len(hits) == 1 {
+				line += "\n" + product
+			} else {
+				line += " " + product
+			}
+		}
+		lines[i] = line
+	}
+	return postWebhook(webhookURL, map[string]interface{}{
+		"embeds": []map[string]interface{}{{
+			"title":       title,
+			"description": strings.Join(lines, "\n"),
+			"color":       embedGreen,
+			"footer":      map[string]string{"text": "Xbox Code Checker | github.com/Tainted06/Xbox-Code-Checker"},
+			"timestamp":   time.Now().Format(time.RFC3339),
+		}},
+	})
+}
+
+// Collects valid codes and sends them in one message once size are waiting or every interval,
+// so a flurry of hits doesn't get the webhook ratelimited by Discord
+type webhookBatcher struct {
+	url      string
+	size     int
+	interval time.Duration
+	mu       sync.Mutex
+	hits     []webhookHit
+	full     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Start sending batches to webhookURL, size 1 sends every hit straight away
+func newWebhookBatcher(webhookURL string, size int, interval time.Duration) *webhookBatcher {
+	if size < 1 {
+		size = 1
+	} else if size > maxWebhookBatch {
+		size = maxWebhookBatch
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	b := &webhookBatcher{url: webhookURL, size: size, interval: interval, full: make(chan struct{}, 1), stop: make(chan struct{}), done: make(chan struct{})}
+	go b.run()
+	return b
+}
+
+// Queue a valid code
+func (b *webhookBatcher) add(code string, product string) {
+	b.mu.Lock()
+	b.hits = append(b.hits, webhookHit{code: code, product: product})
+	full := len(b.hits) >= b.size
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Send the waiting hits on a full batch or the interval, until Close
+func (b *webhookBatcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.full:
+		case <-ticker.C:
+		case <-b.stop:
+			b.flush()
+			return
+		}
+		b.flush()
+	}
+}
+
+// Send every waiting hit, in batches of size
+func (b *webhookBatcher) flush() {
+	b.mu.Lock()
+	hits := b.hits
+	b.hits = nil
+	b.mu.Unlock()
+	for len(hits) > 0 {
+		n := b.size
+		if n > len(hits) {
+			n = len(hits)
+		}
+		if err := notifyWebhook(b.url, hits[:n]); err != nil {
+			logError(" [!] Failed to send webhook:", err)
+		}
+		hits = hits[n:]
+	}
+}
+
+// Send what is left and stop
+func (b *webhookBatcher) Close() {
+	close(b.stop)
+	<-b.done
+}
+
+// Send a Discord embed with the counts and duration of a finished run
+func sendSummaryWebhook(webhookURL string, stats StatsSnapshot, stopped bool) error {
+	title := "Finished checking codes"
+	if stopped {
+		title = "Stopped checking codes"
+	}
+	color := embedBlue
+	if stats.Valid > 0 {
+		color = embedGreen
+	}
+	field := func(name string, value int) map[string]interface{} {
+		return map[string]interface{}{"name": name, "value": strconv.Itoa(value), "inline": true}
+	}
+	return postWebhook(webhookURL, map[string]interface{}{
+		"embeds": []map[string]interface{}{{
+			"title":       title,
+			"description": strconv.Itoa(stats.total()) + " codes checked in " + stats.elapsed().Round(time.Second).String(),
+			"color":       color,
+			"fields": []map[string]interface{}{
+				field("Valid", stats.Valid),
+				field("Used", stats.Used),
+				field("Pending", stats.Pending),
+				field("Expired", stats.Expired),
+				field("Invalid", stats.Invalid),
+				field("Unknown", stats.Unknown),
+				field("Errors", stats.Errors),
+			},
+			"footer":    map[string]string{"text": "Xbox Code Checker | github.com/Tainted06/Xbox-Code-Checker"},
+			"timestamp": time.Now().Format(time.RFC3339),
+		}},
+	})
+}
+
+// POST a JSON payload to a webhook
+func postWebhook(webhookURL string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookBatcher(t *testing.T) {
+	var mu sync.Mutex
+	var descriptions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Embeds []struct {
+				Description string `json:"description"`
+			} `json:"embeds"`
+		}
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		descriptions = append(descriptions, payload.Embeds[0].Description)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	b := newWebhookBatcher(server.URL, 2, time.Hour)
+	b.add("AAAAA-AAAAA-AAAAA-AAAAA-AAAAA", "Game")
+	b.add("BBBBB-BBBBB-BBBBB-BBBBB-BBBBB", "")
+	b.add("CCCCC-CCCCC-CCCCC-CCCCC-CCCCC", "")
+	b.Close()
+
+	// The full batch goes out as one message and the rest is sent on Close
+	if len(descriptions) != 2 || strings.Count(descriptions[0], "\n") != 1 || !strings.Contains(descriptions[0], "AAAAA-AAAAA-AAAAA-XXXXX-XXXXX` Game") || !strings.HasPrefix(descriptions[1], "`CCCCC") {
+		t.Errorf("messages = %q", descriptions)
+	}
+}
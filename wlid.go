@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+
+	"XboxChecker/checker"
+)
+
+// Read the WLIDs from a file, or stdin for -, along with the line each one is on
+func loadWLIDs(path string) (wlids []string, lines []int, malformed int, err error) {
+	f, err := openInput(path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		wlid, ok := checker.ParseWLID(text)
+		if !ok {
+			malformed++
+			continue
+		}
+		wlids = append(wlids, wlid)
+		lines = append(lines, line)
+	}
+	return wlids, lines, malformed, scanner.Err()
+}